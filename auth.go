@@ -0,0 +1,572 @@
+package nie
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTokenInvalid token 格式错误、已过期、已轮换或已吊销
+var ErrTokenInvalid = errors.New("token: invalid or expired")
+
+const (
+	defaultCaptchaTTL      = 5 * time.Minute
+	defaultAccessTokenTTL  = 2 * time.Hour
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	defaultTokenStoreName  = "token"
+	defaultTokenDevice     = "default"
+)
+
+// takeScript 读取并删除 key，返回原值；key 不存在时返回 nil
+var takeScript = redis.NewScript(`
+local v = redis.call("get", KEYS[1])
+if v then
+	redis.call("del", KEYS[1])
+end
+return v
+`)
+
+// tokenIssueScript 写入新会话并更新用户索引，同时删除该设备上的旧会话
+//
+// KEYS[1] 用户索引；KEYS[2] access 摘要；KEYS[3] refresh 摘要；KEYS[4] 会话；
+// ARGV[1] 设备；ARGV[2] 会话 ID；ARGV[3] access 摘要；ARGV[4] refresh 摘要；ARGV[5] 会话数据；
+// ARGV[6] access 过期时间（毫秒）；ARGV[7] refresh 过期时间（毫秒）；ARGV[8..10] access、refresh、会话 key 前缀
+var tokenIssueScript = redis.NewScript(`
+local old = redis.call("hget", KEYS[1], ARGV[1])
+if old then
+	redis.call("del", ARGV[8] .. old, ARGV[9] .. old, ARGV[10] .. old)
+end
+redis.call("set", KEYS[2], ARGV[3], "px", ARGV[6])
+redis.call("set", KEYS[3], ARGV[4], "px", ARGV[7])
+redis.call("del", KEYS[4])
+redis.call("hset", KEYS[4], "data", ARGV[5], "user", KEYS[1], "device", ARGV[1])
+redis.call("pexpire", KEYS[4], ARGV[7])
+redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
+local ttl = tonumber(ARGV[7])
+if redis.call("pttl", KEYS[1]) < ttl then
+	redis.call("pexpire", KEYS[1], ttl)
+end
+return 1
+`)
+
+// tokenValidateScript 校验 access token 摘要，通过时返回会话数据
+//
+// KEYS[1] access 摘要；KEYS[2] 会话；ARGV[1] 待校验的摘要
+var tokenValidateScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("hget", KEYS[2], "data")
+end
+return false
+`)
+
+// tokenRotateScript 校验 refresh token 摘要，通过时同时替换 access 与 refresh 摘要并延长会话与用户索引
+//
+// KEYS[1] refresh 摘要；KEYS[2] access 摘要；KEYS[3] 会话；
+// ARGV[1] 待校验的 refresh 摘要；ARGV[2] 新 access 摘要；ARGV[3] 新 refresh 摘要；
+// ARGV[4] access 过期时间（毫秒）；ARGV[5] refresh 过期时间（毫秒）。
+// 校验与替换在同一脚本内完成，同一个 refresh token 只能兑换一次
+var tokenRotateScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) ~= ARGV[1] then
+	return false
+end
+local v = redis.call("hmget", KEYS[3], "data", "user")
+if not v[1] then
+	redis.call("del", KEYS[1], KEYS[2])
+	return false
+end
+redis.call("set", KEYS[2], ARGV[2], "px", ARGV[4])
+redis.call("set", KEYS[1], ARGV[3], "px", ARGV[5])
+redis.call("pexpire", KEYS[3], ARGV[5])
+local ttl = tonumber(ARGV[5])
+if v[2] and redis.call("pttl", v[2]) < ttl then
+	redis.call("pexpire", v[2], ttl)
+end
+return v[1]
+`)
+
+// tokenRevokeScript 删除会话，设备仍指向该会话时同时从用户索引中移除
+//
+// KEYS[1] access 摘要；KEYS[2] refresh 摘要；KEYS[3] 会话；ARGV[1] 会话 ID
+var tokenRevokeScript = redis.NewScript(`
+local v = redis.call("hmget", KEYS[3], "user", "device")
+redis.call("del", KEYS[1], KEYS[2], KEYS[3])
+if v[1] and v[2] and redis.call("hget", v[1], v[2]) == ARGV[1] then
+	redis.call("hdel", v[1], v[2])
+end
+return 1
+`)
+
+// tokenRevokeDeviceScript 删除设备当前的会话并从用户索引中移除，返回吊销的会话数量
+//
+// KEYS[1] 用户索引；ARGV[1] 设备；ARGV[2..4] access、refresh、会话 key 前缀
+var tokenRevokeDeviceScript = redis.NewScript(`
+local sid = redis.call("hget", KEYS[1], ARGV[1])
+if not sid then
+	return 0
+end
+redis.call("hdel", KEYS[1], ARGV[1])
+redis.call("del", ARGV[2] .. sid, ARGV[3] .. sid)
+return redis.call("del", ARGV[4] .. sid)
+`)
+
+// tokenRevokeAllScript 删除用户索引中的全部会话与索引本身，返回吊销的会话数量
+//
+// KEYS[1] 用户索引；ARGV[1..3] access、refresh、会话 key 前缀
+var tokenRevokeAllScript = redis.NewScript(`
+local index = redis.call("hgetall", KEYS[1])
+local n = 0
+for i = 2, #index, 2 do
+	local sid = index[i]
+	redis.call("del", ARGV[1] .. sid, ARGV[2] .. sid)
+	n = n + redis.call("del", ARGV[3] .. sid)
+end
+redis.call("del", KEYS[1])
+return n
+`)
+
+// tokenListScript 返回用户索引中仍有效的会话数据，并清理已过期的会话
+//
+// KEYS[1] 用户索引；ARGV[1] 会话 key 前缀
+var tokenListScript = redis.NewScript(`
+local index = redis.call("hgetall", KEYS[1])
+local sessions = {}
+for i = 1, #index, 2 do
+	local data = redis.call("hget", ARGV[1] .. index[i + 1], "data")
+	if data then
+		table.insert(sessions, data)
+	else
+		redis.call("hdel", KEYS[1], index[i])
+	end
+end
+return sessions
+`)
+
+// CaptchaStoreOptions 定义验证码存储可选参数
+type CaptchaStoreOptions struct {
+	TTL             time.Duration // 验证码有效期，默认 5 分钟
+	CaseInsensitive bool          // 校验时忽略大小写
+}
+
+// CaptchaStore 验证码存储
+//
+// 验证码只能校验一次：Verify 原子地读取并删除，无论答案是否正确都会失效，防止暴力尝试
+type CaptchaStore struct {
+	c       *Cache
+	key     *KeyTemplate
+	options CaptchaStoreOptions
+}
+
+// NewCaptchaStore 创建验证码存储，key 为 "<Namespace>:captcha:{id}"
+//
+// key 族 "captcha" 已按其他模式定义时返回错误
+func (c *Cache) NewCaptchaStore(options ...CaptchaStoreOptions) (*CaptchaStore, error) {
+	var option CaptchaStoreOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.TTL <= 0 {
+		option.TTL = defaultCaptchaTTL
+	}
+	key, err := c.keys.Define("captcha", "captcha:{id}", KeyTemplateOptions{Description: "验证码"})
+	if err != nil {
+		return nil, err
+	}
+	return &CaptchaStore{c: c, key: key, options: option}, nil
+}
+
+// Generate 保存验证码答案并返回随机生成的验证码 ID
+func (s *CaptchaStore) Generate(ctx context.Context, answer string) (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Set(ctx, id, answer); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Set 保存验证码答案，相同 id 会覆盖旧答案
+func (s *CaptchaStore) Set(ctx context.Context, id, answer string) error {
+	key, err := s.key.Key(id)
+	if err != nil {
+		return err
+	}
+	return s.c.redis.Set(ctx, key, s.normalize(answer), s.options.TTL).Err()
+}
+
+// Verify 校验验证码并使其失效，验证码不存在或已过期时返回 false
+func (s *CaptchaStore) Verify(ctx context.Context, id, answer string) (bool, error) {
+	key, err := s.key.Key(id)
+	if err != nil {
+		return false, nil
+	}
+	stored, err := takeScript.Run(ctx, s.c.redis, []string{key}).Text()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(s.normalize(answer))) == 1, nil
+}
+
+// normalize 按配置统一答案的大小写
+func (s *CaptchaStore) normalize(answer string) string {
+	if s.options.CaseInsensitive {
+		return strings.ToLower(answer)
+	}
+	return answer
+}
+
+// TokenStoreOptions 定义 token 存储可选参数
+type TokenStoreOptions struct {
+	Name       string        // key 前缀与 key 族名称前缀，默认 "token"；同一命名空间下多套 token 体系时用于区分
+	AccessTTL  time.Duration // access token 有效期，默认 2 小时
+	RefreshTTL time.Duration // refresh token 有效期（即会话有效期），默认 7 天
+}
+
+// TokenClaims 签发 token 时的会话信息
+type TokenClaims struct {
+	Uid          int64             `json:"uid"`
+	EnterpriseId int64             `json:"enterpriseId"`
+	Device       string            `json:"device"`          // 设备标识，同一用户同一设备只保留一个会话，默认 "default"
+	Extra        map[string]string `json:"extra,omitempty"` // 业务自定义数据
+}
+
+// TokenSession 会话信息
+type TokenSession struct {
+	TokenClaims
+	ID       string    `json:"id"`       // 会话 ID
+	IssuedAt time.Time `json:"issuedAt"` // 签发时间
+}
+
+// TokenPair 签发或轮换得到的一组 token
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+	Session          *TokenSession
+}
+
+// TokenStore access/refresh token 存储
+//
+// token 格式为 "<会话ID>.<随机串>"，Redis 中只保存随机串的 SHA-256 摘要。
+// 会话 ID 以用户哈希标签开头（由 enterpriseId、uid 计算），同一用户的会话与用户索引（按设备记录会话）落在同一哈希槽，
+// 签发、校验、轮换、吊销与列出均由单个脚本原子完成，可用于集群客户端
+type TokenStore struct {
+	c       *Cache
+	options TokenStoreOptions
+	access  *KeyTemplate
+	refresh *KeyTemplate
+	session *KeyTemplate
+	user    *KeyTemplate
+}
+
+// NewTokenStore 创建 token 存储
+//
+// 同一 Cache 上以相同 Name 重复创建时复用已定义的 key 族，key 族已按其他模式定义时返回错误
+func (c *Cache) NewTokenStore(options ...TokenStoreOptions) (*TokenStore, error) {
+	var option TokenStoreOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Name == "" {
+		option.Name = defaultTokenStoreName
+	}
+	if option.AccessTTL <= 0 {
+		option.AccessTTL = defaultAccessTokenTTL
+	}
+	if option.RefreshTTL <= 0 {
+		option.RefreshTTL = defaultRefreshTokenTTL
+	}
+	name := option.Name
+	tag := KeyTemplateOptions{HashTag: "tag"}
+	s := &TokenStore{c: c, options: option}
+	for _, k := range []struct {
+		family  string
+		pattern string
+		dst     **KeyTemplate
+	}{
+		{"access", ":access:{tag}:{sid}", &s.access},
+		{"refresh", ":refresh:{tag}:{sid}", &s.refresh},
+		{"session", ":session:{tag}:{sid}", &s.session},
+		{"user", ":user:{tag}:{enterpriseId}:{uid}", &s.user},
+	} {
+		t, err := c.keys.Define(name+"."+k.family, name+k.pattern, tag)
+		if err != nil {
+			return nil, err
+		}
+		*k.dst = t
+	}
+	return s, nil
+}
+
+// Issue 签发一组 token；该用户在同一设备上已有的会话会被吊销
+func (s *TokenStore) Issue(ctx context.Context, claims TokenClaims) (*TokenPair, error) {
+	if claims.Device == "" {
+		claims.Device = defaultTokenDevice
+	}
+	tag := tokenUserTag(claims.EnterpriseId, claims.Uid)
+	userKey, err := s.user.Key(tag, claims.EnterpriseId, claims.Uid)
+	if err != nil {
+		return nil, err
+	}
+	random, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	sid := tag + "-" + random
+	keys, err := s.sessionKeys(sid)
+	if err != nil {
+		return nil, err
+	}
+	accessSecret, refreshSecret, err := newTokenSecrets()
+	if err != nil {
+		return nil, err
+	}
+	session := &TokenSession{TokenClaims: claims, ID: sid, IssuedAt: s.c.now()}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]interface{}{claims.Device, sid, tokenDigest(accessSecret), tokenDigest(refreshSecret), data,
+		s.options.AccessTTL.Milliseconds(), s.options.RefreshTTL.Milliseconds()}, s.sessionPrefixes(tag)...)
+	if err := tokenIssueScript.Run(ctx, s.c.redis, append([]string{userKey}, keys...), args...).Err(); err != nil {
+		return nil, err
+	}
+	return s.pair(sid, accessSecret, refreshSecret, session), nil
+}
+
+// Validate 校验 access token，返回对应的会话
+func (s *TokenStore) Validate(ctx context.Context, accessToken string) (*TokenSession, error) {
+	sid, secret, ok := splitToken(accessToken)
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	keys, err := s.sessionKeys(sid)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	data, err := tokenValidateScript.Run(ctx, s.c.redis, []string{keys[0], keys[2]}, tokenDigest(secret)).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeTokenSession(data)
+}
+
+// Session 按会话 ID 获取会话，会话不存在、已过期或已吊销时返回 ErrTokenInvalid
+//
+// 用于校验携带会话 ID 的其他凭证（如 JWTOptions.TokenStore）
+func (s *TokenStore) Session(ctx context.Context, sid string) (*TokenSession, error) {
+	keys, err := s.sessionKeys(sid)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	data, err := s.c.redis.HGet(ctx, keys[2], "data").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeTokenSession(data)
+}
+
+// Refresh 使用 refresh token 轮换出一组新的 token
+//
+// 旧的 access token 与 refresh token 同时失效；同一个 refresh token 并发兑换时只有一次成功，其余返回 ErrTokenInvalid
+func (s *TokenStore) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	sid, secret, ok := splitToken(refreshToken)
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	keys, err := s.sessionKeys(sid)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	accessSecret, refreshSecret, err := newTokenSecrets()
+	if err != nil {
+		return nil, err
+	}
+	data, err := tokenRotateScript.Run(ctx, s.c.redis, []string{keys[1], keys[0], keys[2]},
+		tokenDigest(secret), tokenDigest(accessSecret), tokenDigest(refreshSecret),
+		s.options.AccessTTL.Milliseconds(), s.options.RefreshTTL.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	session, err := decodeTokenSession(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.pair(sid, accessSecret, refreshSecret, session), nil
+}
+
+// Revoke 吊销 token 所属的会话，token 可以是 access token 或 refresh token；会话不存在时不返回错误
+func (s *TokenStore) Revoke(ctx context.Context, token string) error {
+	sid, _, ok := splitToken(token)
+	if !ok {
+		return nil
+	}
+	keys, err := s.sessionKeys(sid)
+	if err != nil {
+		return nil
+	}
+	return tokenRevokeScript.Run(ctx, s.c.redis, keys, sid).Err()
+}
+
+// RevokeDevice 吊销用户在指定设备上的会话
+func (s *TokenStore) RevokeDevice(ctx context.Context, enterpriseId, uid int64, device string) error {
+	if device == "" {
+		device = defaultTokenDevice
+	}
+	userKey, tag, err := s.userKey(enterpriseId, uid)
+	if err != nil {
+		return err
+	}
+	return tokenRevokeDeviceScript.Run(ctx, s.c.redis, []string{userKey}, append([]interface{}{device}, s.sessionPrefixes(tag)...)...).Err()
+}
+
+// RevokeAll 吊销用户在所有设备上的会话，返回吊销的会话数量
+func (s *TokenStore) RevokeAll(ctx context.Context, enterpriseId, uid int64) (int, error) {
+	userKey, tag, err := s.userKey(enterpriseId, uid)
+	if err != nil {
+		return 0, err
+	}
+	n, err := tokenRevokeAllScript.Run(ctx, s.c.redis, []string{userKey}, s.sessionPrefixes(tag)...).Int()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// List 返回用户当前有效的会话，按签发时间升序；已过期的会话会从用户索引中清理
+func (s *TokenStore) List(ctx context.Context, enterpriseId, uid int64) ([]*TokenSession, error) {
+	userKey, tag, err := s.userKey(enterpriseId, uid)
+	if err != nil {
+		return nil, err
+	}
+	values, err := tokenListScript.Run(ctx, s.c.redis, []string{userKey}, s.sessionPrefixes(tag)[2]).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*TokenSession, 0, len(values))
+	for _, data := range values {
+		session, err := decodeTokenSession(data)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].IssuedAt.Before(sessions[j].IssuedAt) })
+	return sessions, nil
+}
+
+// userKey 返回用户索引 key 与用户哈希标签
+func (s *TokenStore) userKey(enterpriseId, uid int64) (string, string, error) {
+	tag := tokenUserTag(enterpriseId, uid)
+	key, err := s.user.Key(tag, enterpriseId, uid)
+	return key, tag, err
+}
+
+// sessionKeys 返回会话的 access 摘要、refresh 摘要与会话 key，会话 ID 格式错误时返回错误
+func (s *TokenStore) sessionKeys(sid string) ([]string, error) {
+	tag, _, ok := strings.Cut(sid, "-")
+	if !ok || tag == "" {
+		return nil, ErrTokenInvalid
+	}
+	access, err := s.access.Key(tag, sid)
+	if err != nil {
+		return nil, err
+	}
+	return []string{access, s.refresh.MustKey(tag, sid), s.session.MustKey(tag, sid)}, nil
+}
+
+// sessionPrefixes 返回用户哈希槽内 access 摘要、refresh 摘要与会话 key 去掉会话 ID 后的前缀，供脚本按会话 ID 拼接
+func (s *TokenStore) sessionPrefixes(tag string) []interface{} {
+	const placeholder = "_"
+	prefixes := make([]interface{}, 0, 3)
+	for _, t := range []*KeyTemplate{s.access, s.refresh, s.session} {
+		prefixes = append(prefixes, strings.TrimSuffix(t.MustKey(tag, placeholder), placeholder))
+	}
+	return prefixes
+}
+
+// tokenUserTag 由 enterpriseId、uid 计算用户哈希标签，只取摘要前 2 字节，仅用于分配哈希槽
+func tokenUserTag(enterpriseId, uid int64) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(enterpriseId, 10) + ":" + strconv.FormatInt(uid, 10)))
+	return hex.EncodeToString(sum[:2])
+}
+
+// pair 组装返回给调用方的 token
+func (s *TokenStore) pair(sid, accessSecret, refreshSecret string, session *TokenSession) *TokenPair {
+	now := s.c.now()
+	return &TokenPair{
+		AccessToken:      sid + "." + accessSecret,
+		RefreshToken:     sid + "." + refreshSecret,
+		AccessExpiresAt:  now.Add(s.options.AccessTTL),
+		RefreshExpiresAt: now.Add(s.options.RefreshTTL),
+		Session:          session,
+	}
+}
+
+// decodeTokenSession 解析会话数据
+func decodeTokenSession(data string) (*TokenSession, error) {
+	var session TokenSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// splitToken 拆分 "<会话ID>.<随机串>"
+func splitToken(token string) (sid, secret string, ok bool) {
+	sid, secret, ok = strings.Cut(token, ".")
+	return sid, secret, ok && sid != "" && secret != ""
+}
+
+// newTokenSecrets 生成 access 与 refresh 随机串
+func newTokenSecrets() (string, string, error) {
+	access, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// tokenDigest 返回随机串的 SHA-256 摘要，Redis 中不保存 token 明文
+func tokenDigest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex 生成 n 字节的随机数并以十六进制返回
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
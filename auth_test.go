@@ -0,0 +1,191 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestCaptchaStore(t *testing.T) {
+	c, r := nietest.NewCache(t, nie.CacheOptions{Namespace: "auth"})
+	ctx := context.Background()
+	captcha, err := c.NewCaptchaStore(nie.CaptchaStoreOptions{TTL: time.Minute, CaseInsensitive: true})
+	if err != nil {
+		t.Fatalf("NewCaptchaStore error: %v", err)
+	}
+
+	id, err := captcha.Generate(ctx, "AbC1")
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if !r.Server().Exists("auth:captcha:" + id) {
+		t.Fatal("captcha key should be namespaced")
+	}
+	if ok, err := captcha.Verify(ctx, id, "abc1"); err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+	if ok, _ := captcha.Verify(ctx, id, "abc1"); ok {
+		t.Fatal("captcha should be single-use")
+	}
+
+	id, _ = captcha.Generate(ctx, "xyz")
+	if ok, _ := captcha.Verify(ctx, id, "wrong"); ok {
+		t.Fatal("wrong answer should fail")
+	}
+	if ok, _ := captcha.Verify(ctx, id, "xyz"); ok {
+		t.Fatal("captcha should be consumed by a wrong answer")
+	}
+
+	id, _ = captcha.Generate(ctx, "late")
+	r.Advance(time.Minute)
+	if ok, err := captcha.Verify(ctx, id, "late"); err != nil || ok {
+		t.Fatalf("expired Verify = %v, %v", ok, err)
+	}
+}
+
+func TestAuthStores_KeyConflict(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	c.Keys().MustDefine("captcha", "captcha:{code}")
+	if _, err := c.NewCaptchaStore(); err == nil {
+		t.Fatal("NewCaptchaStore should fail when the captcha family is defined with another pattern")
+	}
+
+	// 相同 Name 重复创建复用已定义的 key 族
+	if _, err := c.NewTokenStore(); err != nil {
+		t.Fatalf("NewTokenStore error: %v", err)
+	}
+	if _, err := c.NewTokenStore(); err != nil {
+		t.Fatalf("NewTokenStore again error: %v", err)
+	}
+	c.Keys().MustDefine("sso.user", "sso:user:{uid}")
+	if _, err := c.NewTokenStore(nie.TokenStoreOptions{Name: "sso"}); err == nil {
+		t.Fatal("NewTokenStore should fail when a token family is defined with another pattern")
+	}
+}
+
+func TestTokenStore_IssueValidateRefresh(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	tokens, err := c.NewTokenStore(nie.TokenStoreOptions{AccessTTL: time.Minute, RefreshTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTokenStore error: %v", err)
+	}
+
+	pair, err := tokens.Issue(ctx, nie.TokenClaims{Uid: 1, EnterpriseId: 9, Device: "ios", Extra: map[string]string{"role": "admin"}})
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	session, err := tokens.Validate(ctx, pair.AccessToken)
+	if err != nil || session.Uid != 1 || session.EnterpriseId != 9 || session.Extra["role"] != "admin" {
+		t.Fatalf("Validate = %+v, %v", session, err)
+	}
+	if _, err := tokens.Validate(ctx, pair.RefreshToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("refresh token must not validate as access token, got %v", err)
+	}
+	for _, bad := range []string{"", "x", "a.b", "a:b.c"} {
+		if _, err := tokens.Validate(ctx, bad); !errors.Is(err, nie.ErrTokenInvalid) {
+			t.Fatalf("Validate(%q) error = %v", bad, err)
+		}
+	}
+
+	r.Advance(time.Minute)
+	if _, err := tokens.Validate(ctx, pair.AccessToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("expired access token error = %v", err)
+	}
+
+	// 并发兑换同一个 refresh token 只能成功一次
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	var next *nie.TokenPair
+	var mu sync.Mutex
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := tokens.Refresh(ctx, pair.RefreshToken)
+			if err == nil {
+				ok.Add(1)
+				mu.Lock()
+				next = p
+				mu.Unlock()
+			} else if !errors.Is(err, nie.ErrTokenInvalid) {
+				t.Errorf("Refresh error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := ok.Load(); n != 1 {
+		t.Fatalf("refresh succeeded %d times, want 1", n)
+	}
+	if s, err := tokens.Validate(ctx, next.AccessToken); err != nil || s.ID != session.ID {
+		t.Fatalf("Validate rotated token = %+v, %v", s, err)
+	}
+	if _, err := tokens.Refresh(ctx, pair.RefreshToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("old refresh token error = %v", err)
+	}
+
+	r.Advance(time.Hour)
+	if _, err := tokens.Refresh(ctx, next.RefreshToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("expired refresh token error = %v", err)
+	}
+}
+
+func TestTokenStore_Sessions(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	tokens, err := c.NewTokenStore()
+	if err != nil {
+		t.Fatalf("NewTokenStore error: %v", err)
+	}
+
+	ios, _ := tokens.Issue(ctx, nie.TokenClaims{Uid: 1, EnterpriseId: 9, Device: "ios"})
+	r.Advance(time.Second)
+	web, _ := tokens.Issue(ctx, nie.TokenClaims{Uid: 1, EnterpriseId: 9, Device: "web"})
+	r.Advance(time.Second)
+	other, _ := tokens.Issue(ctx, nie.TokenClaims{Uid: 2, EnterpriseId: 9})
+
+	// 同一设备重新登录会顶掉旧会话
+	ios2, err := tokens.Issue(ctx, nie.TokenClaims{Uid: 1, EnterpriseId: 9, Device: "ios"})
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if _, err := tokens.Validate(ctx, ios.AccessToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("replaced session should be revoked, got %v", err)
+	}
+
+	sessions, err := tokens.List(ctx, 9, 1)
+	if err != nil || len(sessions) != 2 || sessions[0].Device != "web" || sessions[1].Device != "ios" {
+		t.Fatalf("List = %+v, %v", sessions, err)
+	}
+
+	if err := tokens.RevokeDevice(ctx, 9, 1, "web"); err != nil {
+		t.Fatalf("RevokeDevice error: %v", err)
+	}
+	if _, err := tokens.Validate(ctx, web.AccessToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("revoked device token error = %v", err)
+	}
+	if err := tokens.Revoke(ctx, ios2.RefreshToken); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	if sessions, _ := tokens.List(ctx, 9, 1); len(sessions) != 0 {
+		t.Fatalf("List after revoke = %+v", sessions)
+	}
+
+	if n, err := tokens.RevokeAll(ctx, 9, 2); err != nil || n != 1 {
+		t.Fatalf("RevokeAll = %d, %v", n, err)
+	}
+	if _, err := tokens.Validate(ctx, other.AccessToken); !errors.Is(err, nie.ErrTokenInvalid) {
+		t.Fatalf("RevokeAll token error = %v", err)
+	}
+
+	// 吊销后不残留会话与用户索引
+	if keys := r.Server().Keys(); len(keys) != 0 {
+		t.Fatalf("keys left after revoke = %v", keys)
+	}
+}
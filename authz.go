@@ -0,0 +1,136 @@
+package nie
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// ErrPermissionDenied 缺少访问权限，metadata 中的 operation 为访问的接口，missing 为缺少的角色或权限（逗号分隔）
+var ErrPermissionDenied = kerrors.Forbidden("PERMISSION_DENIED", "无权访问")
+
+// AuthzRequirement 访问接口需要的角色与权限
+//
+// 默认满足任一角色或任一权限即可；All 为 true 时需要全部角色与全部权限。
+// Roles 与 Permissions 都为空时只要求已登录（uid 不为 0）
+type AuthzRequirement struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	All         bool     `json:"all"`
+}
+
+// AuthzOptions 定义 AuthzMiddleware 参数，带 json 标签，可直接从配置文件解析
+type AuthzOptions struct {
+	// Rules 接口（transport.Operation）到访问要求的映射，以 "*" 结尾的 key 按前缀匹配，如 "/user.v1.User/*"，
+	// 单独的 "*" 匹配所有接口；精确匹配优先，其次为最长的前缀
+	Rules map[string]AuthzRequirement `json:"rules"`
+	// RolePermissions 角色拥有的权限，权限以 "*" 结尾时按前缀授予，如 "order:*"，单独的 "*" 授予全部权限
+	RolePermissions map[string][]string `json:"rolePermissions"`
+	// SuperAdmin 非 nil 时返回 true 的用户跳过检查；req 为请求参数，
+	// 实现时应比较所访问资源的企业与 identity.EnterpriseId，避免某个企业的管理员越权访问其他企业的数据
+	SuperAdmin func(ctx context.Context, identity *Identity, req interface{}) bool `json:"-"`
+}
+
+// AuthzMiddleware 按接口配置的角色与权限检查访问，未匹配任何规则的接口不做检查
+//
+// 角色取自 IdentityMiddleware 或 JWTMiddleware 存入的 Identity，没有时取自 context 中的 role 值，需放在认证中间件之后。
+// 未登录返回 ErrIdentityMissing，权限不足返回 ErrPermissionDenied
+func AuthzMiddleware(options AuthzOptions) middleware.Middleware {
+	exact := make(map[string]AuthzRequirement)
+	var prefixes []string
+	for op, req := range options.Rules {
+		if strings.HasSuffix(op, "*") {
+			prefixes = append(prefixes, op)
+		} else {
+			exact[op] = req
+		}
+	}
+	// 最长前缀优先
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var operation string
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				operation = tr.Operation()
+			}
+			requirement, ok := exact[operation]
+			if !ok {
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(operation, strings.TrimSuffix(prefix, "*")) {
+						requirement, ok = options.Rules[prefix], true
+						break
+					}
+				}
+			}
+			if !ok {
+				return handler(ctx, req)
+			}
+
+			identity, has := IdentityFromContext(ctx)
+			if !has {
+				identity = &Identity{Uid: CtxUid(ctx), EnterpriseId: CtxEnterpriseId(ctx), Roles: ctxArr(ctx, CtxRoleKey)}
+			}
+			if identity.Uid == 0 {
+				return nil, ErrIdentityMissing
+			}
+			if options.SuperAdmin != nil && options.SuperAdmin(ctx, identity, req) {
+				return handler(ctx, req)
+			}
+			if missing := requirement.missing(identity.Roles, options.RolePermissions); len(missing) > 0 {
+				return nil, ErrPermissionDenied.WithMetadata(map[string]string{
+					"operation": operation,
+					"missing":   strings.Join(missing, ","),
+				})
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// missing 返回未满足的角色与权限，满足要求时返回 nil
+//
+// 任一模式下未满足时返回全部要求的角色与权限
+func (r AuthzRequirement) missing(roles []string, rolePermissions map[string][]string) []string {
+	if len(r.Roles) == 0 && len(r.Permissions) == 0 {
+		return nil
+	}
+	var granted []string
+	for _, role := range roles {
+		granted = append(granted, rolePermissions[role]...)
+	}
+	var missing []string
+	satisfied := 0
+	for _, role := range r.Roles {
+		if contains(roles, role) {
+			satisfied++
+		} else {
+			missing = append(missing, role)
+		}
+	}
+	for _, permission := range r.Permissions {
+		if hasPermission(granted, permission) {
+			satisfied++
+		} else {
+			missing = append(missing, permission)
+		}
+	}
+	if r.All || satisfied == 0 {
+		return missing
+	}
+	return nil
+}
+
+// hasPermission 判断已授予的权限是否包含 permission，支持 "*" 结尾的前缀授权
+func hasPermission(granted []string, permission string) bool {
+	for _, g := range granted {
+		if g == permission || strings.HasSuffix(g, "*") && strings.HasPrefix(permission, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
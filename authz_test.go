@@ -0,0 +1,95 @@
+package nie_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestAuthzMiddleware(t *testing.T) {
+	var options nie.AuthzOptions
+	config := `{
+		"rules": {
+			"/order.v1.Order/Delete": {"permissions": ["order:delete"]},
+			"/order.v1.Order/*": {"permissions": ["order:read", "order:write"]},
+			"/admin.v1.Admin/Audit": {"roles": ["admin", "auditor"], "all": true},
+			"/user.v1.User/*": {}
+		},
+		"rolePermissions": {"staff": ["order:read"], "manager": ["order:*"]}
+	}`
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		t.Fatalf("config error: %v", err)
+	}
+	handler := nie.AuthzMiddleware(options)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	callReq := func(operation string, req interface{}, uid int64, roles ...string) error {
+		ctx := transport.NewServerContext(context.Background(), newTestTransport(operation))
+		ctx = nie.NewIdentityContext(ctx, &nie.Identity{Uid: uid, EnterpriseId: 1, Roles: roles})
+		_, err := handler(ctx, req)
+		return err
+	}
+	call := func(operation string, uid int64, roles ...string) error {
+		return callReq(operation, nil, uid, roles...)
+	}
+
+	cases := []struct {
+		operation string
+		uid       int64
+		roles     []string
+		missing   string // 为空表示允许访问
+	}{
+		{"/order.v1.Order/List", 1, []string{"staff"}, ""},
+		{"/order.v1.Order/List", 1, []string{"guest"}, "order:read,order:write"},
+		{"/order.v1.Order/Delete", 1, []string{"staff"}, "order:delete"},
+		{"/order.v1.Order/Delete", 1, []string{"manager"}, ""},
+		{"/admin.v1.Admin/Audit", 1, []string{"admin"}, "auditor"},
+		{"/admin.v1.Admin/Audit", 1, []string{"admin", "auditor"}, ""},
+		{"/user.v1.User/Get", 1, nil, ""},
+		{"/public.v1.Public/Ping", 0, nil, ""},
+	}
+	for _, tc := range cases {
+		err := call(tc.operation, tc.uid, tc.roles...)
+		if tc.missing == "" {
+			if err != nil {
+				t.Fatalf("%s %v: error = %v", tc.operation, tc.roles, err)
+			}
+			continue
+		}
+		e := kerrors.FromError(err)
+		if !kerrors.IsForbidden(err) || e.Metadata["missing"] != tc.missing || e.Metadata["operation"] != tc.operation {
+			t.Fatalf("%s %v: error = %v", tc.operation, tc.roles, err)
+		}
+	}
+
+	if err := call("/user.v1.User/Get", 0); !kerrors.IsUnauthorized(err) {
+		t.Fatalf("anonymous error = %v", err)
+	}
+
+	// 超级管理员只在所属企业内跳过检查
+	options.SuperAdmin = func(ctx context.Context, identity *nie.Identity, req interface{}) bool {
+		r, ok := req.(*authzOrderRequest)
+		return ok && r.EnterpriseId == identity.EnterpriseId && slices.Contains(identity.Roles, "root")
+	}
+	handler = nie.AuthzMiddleware(options)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	if err := callReq("/order.v1.Order/Delete", &authzOrderRequest{EnterpriseId: 1}, 99, "root"); err != nil {
+		t.Fatalf("super admin error = %v", err)
+	}
+	if err := callReq("/order.v1.Order/Delete", &authzOrderRequest{EnterpriseId: 2}, 99, "root"); !kerrors.IsForbidden(err) {
+		t.Fatalf("super admin of another enterprise error = %v", err)
+	}
+	if err := call("/admin.v1.Admin/Audit", 99, "root"); !kerrors.IsForbidden(err) {
+		t.Fatalf("root role without resource enterprise error = %v", err)
+	}
+}
+
+type authzOrderRequest struct {
+	EnterpriseId int64
+}
@@ -0,0 +1,111 @@
+package nie
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxBloomBits Redis 位图的最大长度（2^32 位，即 512MB）
+const maxBloomBits = 1 << 32
+
+// BloomFilter 基于 Redis 位图（SETBIT/GETBIT）的布隆过滤器
+//
+// 用于防止缓存穿透：只有通过 Add 写入过的 key 才可能被判定为存在，
+// 从未写入的 key 一定被判定为不存在（存在一定的误判率，不会漏判）。
+// 整个过滤器存储在单个 Redis key 中，可直接用于集群客户端。
+type BloomFilter struct {
+	redis  redis.Cmdable
+	key    string // 位图所在的 Redis key
+	bits   uint64 // 位图长度 m
+	hashes uint64 // 哈希函数个数 k
+}
+
+// NewBloomFilter 创建布隆过滤器
+//
+// 入参：key 为位图所在的 Redis key；expectedItems 为预计写入的元素个数；falsePositiveRate 为期望误判率（0~1）
+func NewBloomFilter(c *Cache, key string, expectedItems uint64, falsePositiveRate float64) *BloomFilter {
+	if expectedItems == 0 {
+		expectedItems = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	// m = -n*ln(p) / (ln2)^2，k = m/n*ln2
+	m := math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	if m > maxBloomBits {
+		m = maxBloomBits
+	}
+	k := math.Round(m / float64(expectedItems) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{redis: c.redis, key: key, bits: uint64(m), hashes: uint64(k)}
+}
+
+// Add 向布隆过滤器中写入元素
+func (b *BloomFilter) Add(ctx context.Context, items ...string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	_, err := b.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			for _, offset := range b.offsets(item) {
+				pipe.SetBit(ctx, b.key, int64(offset), 1)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Exists 判断元素是否可能存在
+//
+// 返回 false 表示一定不存在；返回 true 表示可能存在
+func (b *BloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	offsets := b.offsets(item)
+	cmds := make([]*redis.IntCmd, len(offsets))
+	_, err := b.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, offset := range offsets {
+			cmds[i] = pipe.GetBit(ctx, b.key, int64(offset))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, cmd := range cmds {
+		if cmd.Val() == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Expire 设置布隆过滤器的过期时间，便于定期重建
+func (b *BloomFilter) Expire(ctx context.Context, expiration time.Duration) error {
+	return b.redis.Expire(ctx, b.key, expiration).Err()
+}
+
+// Reset 清空布隆过滤器
+func (b *BloomFilter) Reset(ctx context.Context) error {
+	return b.redis.Del(ctx, b.key).Err()
+}
+
+// offsets 使用双重哈希（Kirsch-Mitzenmacher）计算元素对应的 k 个位偏移
+func (b *BloomFilter) offsets(item string) []uint64 {
+	h1 := fnv.New64a()
+	_, _ = h1.Write([]byte(item))
+	h2 := fnv.New64()
+	_, _ = h2.Write([]byte(item))
+	x, y := h1.Sum64(), h2.Sum64()|1 // 保证步长为奇数，避免偏移退化
+
+	offsets := make([]uint64, b.hashes)
+	for i := uint64(0); i < b.hashes; i++ {
+		offsets[i] = (x + i*y) % b.bits
+	}
+	return offsets
+}
@@ -0,0 +1,78 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestBloomFilter(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	bloom := nie.NewBloomFilter(c, "bloom:order", 100, 0.01)
+	if err := bloom.Add(ctx); err != nil {
+		t.Fatalf("empty Add error: %v", err)
+	}
+	if s.Exists("bloom:order") {
+		t.Fatal("empty Add should not create the bitmap")
+	}
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = fmt.Sprintf("order:%d", i)
+	}
+	if err := bloom.Add(ctx, items...); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	// 写入过的元素不会漏判
+	for _, item := range items {
+		if ok, err := bloom.Exists(ctx, item); err != nil || !ok {
+			t.Fatalf("Exists(%s) = %v, %v", item, ok, err)
+		}
+	}
+	var falsePositives int
+	for i := 0; i < 1000; i++ {
+		if ok, _ := bloom.Exists(ctx, fmt.Sprintf("other:%d", i)); ok {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Fatalf("false positives = %d of 1000", falsePositives)
+	}
+
+	if err := bloom.Expire(ctx, time.Minute); err != nil || s.TTL("bloom:order") != time.Minute {
+		t.Fatalf("Expire error = %v, ttl = %v", err, s.TTL("bloom:order"))
+	}
+	if err := bloom.Reset(ctx); err != nil {
+		t.Fatalf("Reset error: %v", err)
+	}
+	if ok, err := bloom.Exists(ctx, items[0]); err != nil || ok {
+		t.Fatalf("Exists after Reset = %v, %v", ok, err)
+	}
+}
+
+func TestGetOrLoad_BloomGuard(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	bloom := nie.NewBloomFilter(c, "bloom:user", 1000, 0.01)
+	if err := bloom.Add(ctx, "user:1"); err != nil {
+		t.Fatalf("bloom Add error: %v", err)
+	}
+	loader := func(ctx context.Context) (string, error) { return "u1", nil }
+
+	if v, err := nie.GetOrLoad(ctx, c, "user:1", time.Minute, loader, nie.LoadOptions{Bloom: bloom}); err != nil || v != "u1" {
+		t.Fatalf("GetOrLoad = %q, %v", v, err)
+	}
+	_, err := nie.GetOrLoad(ctx, c, "user:2", time.Minute, func(ctx context.Context) (string, error) {
+		t.Fatal("loader should not be called for keys rejected by bloom filter")
+		return "", nil
+	}, nie.LoadOptions{Bloom: bloom})
+	if !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetOrLoad error = %v, want ErrCacheNotFound", err)
+	}
+}
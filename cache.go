@@ -2,104 +2,289 @@ package nie
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
 )
 
 var DefaultCache *Cache
 
+// ErrCacheNotFound 表示缓存中记录了“数据不存在”（空值缓存），区别于 redis.Nil（缓存未命中）
+var ErrCacheNotFound = errors.New("cache: record not found")
+
+// DefaultNegativeTTL 未配置 CacheOptions.NegativeTTL 时 SetNotFound 使用的过期时间
+const DefaultNegativeTTL = time.Minute
+
+// notFoundSentinel 空值缓存的占位值，以不可见字符开头，不会与正常写入的JSON或业务字符串冲突
+const notFoundSentinel = "\x00nie:not-found\x00"
+
 var (
-	// Deprecated: it will be removed
+	// Deprecated: 使用 Cache.NewCaptchaStore
 	CaptchaPrefix = "captcha:" // 验证码前缀
-	// Deprecated: it will be removed
+	// Deprecated: 使用 Cache.NewTokenStore
 	AccessTokenPrefix = "accessToken:" // accessToken前缀
-	// Deprecated: it will be removed
+	// Deprecated: 使用 Cache.NewTokenStore
 	RefreshTokenPrefix = "refreshToken:" // refreshToken前缀
 )
 
 // Cache 用于管理 Redis 缓存
 type Cache struct {
-	redis redis.Cmdable
+	redis       redis.Cmdable
+	log         *log.Helper          // 内部异步流程（回写、续期等）的错误日志，可为 nil
+	group       *singleflight.Group  // 同一进程内按 key 合并并发加载
+	negativeTTL time.Duration        // 空值缓存过期时间，0 表示 GetOrLoad 不写入空值缓存
+	isNotFound  func(err error) bool // 判断 loader 返回的错误是否表示“数据不存在”
+	stats       *cacheStats          // 各层命中统计
+	codec       Codec                // 复杂类型的编码方式
+	tagPrefix   string               // 标签集合 key 前缀
+	async       *asyncPool           // AsyncSetRedis/AsyncDelRedis 使用的工作池
+	now         func() time.Time     // 当前时间，测试时可替换为可控时钟
+	ttlJitter   *TTLJitterOptions    // 写入过期时间的随机抖动
+	keys        *KeyRegistry         // 带命名空间的 key 模板注册表
+	hooks       []CacheHook          // 操作观测钩子，为空时不产生任何开销
+	breaker     *circuitBreaker      // Redis 熔断器，nil 表示未开启
+
+	local         *localCache // 进程内一级缓存，nil 表示未开启
+	localChannel  string      // 一级缓存失效通知频道
+	localPrefixes []string    // 使用一级缓存的 key 前缀
+
+	closers []func(ctx context.Context) error // Close 时依次执行的清理函数
+}
+
+// CacheOptions 定义 NewCache 可选参数
+type CacheOptions struct {
+	LogHelper      *log.Helper            // 内部异步流程的日志输出，为 nil 时不输出
+	NegativeTTL    time.Duration          // 空值缓存过期时间，大于 0 时 GetOrLoad 会为不存在的数据写入空值缓存
+	IsNotFound     func(err error) bool   // 判断 loader 错误是否表示数据不存在，默认识别 ErrCacheNotFound 与 gorm.ErrRecordNotFound
+	Local          *LocalCacheOptions     // 进程内一级缓存配置，为 nil 时不开启
+	Codec          Codec                  // 复杂类型的编码方式，默认 JSONCodec；读取时按数据头部自动识别
+	TagPrefix      string                 // 标签集合 key 前缀，默认 "tag:"
+	Async          *AsyncOptions          // 异步写入工作池配置，为 nil 时使用默认配置
+	Now            func() time.Time       // 当前时间（一级缓存过期等使用），默认 time.Now，测试时可替换为可控时钟
+	TTLJitter      *TTLJitterOptions      // 写入过期时间的随机抖动，为 nil 时不抖动
+	Namespace      string                 // 应用命名空间，Keys() 定义的 key 与默认的标签集合 key 均以 "<Namespace>:" 开头
+	Hooks          []CacheHook            // 操作观测钩子（指标、链路追踪、慢操作日志等），默认不开启
+	CircuitBreaker *CircuitBreakerOptions // Redis 不可用时熔断降级，为 nil 时不开启
 }
 
 // NewCache 使用已有的 Redis 客户端初始化 Cache
-func NewCache(redis redis.Cmdable) *Cache {
-	return &Cache{redis: redis}
+func NewCache(redis redis.Cmdable, options ...CacheOptions) *Cache {
+	c := &Cache{
+		redis:      redis,
+		group:      &singleflight.Group{},
+		isNotFound: defaultIsNotFound,
+		stats:      &cacheStats{},
+		codec:      JSONCodec,
+		tagPrefix:  defaultTagPrefix,
+		now:        time.Now,
+	}
+	var asyncOption AsyncOptions
+	var namespace string
+	if len(options) > 0 {
+		option := options[0]
+		c.log = option.LogHelper
+		c.negativeTTL = option.NegativeTTL
+		if option.IsNotFound != nil {
+			c.isNotFound = option.IsNotFound
+		}
+		if option.Codec != nil {
+			c.codec = option.Codec
+		}
+		if option.TagPrefix != "" {
+			c.tagPrefix = option.TagPrefix
+		} else if option.Namespace != "" {
+			c.tagPrefix = option.Namespace + ":" + defaultTagPrefix
+		}
+		if option.Now != nil {
+			c.now = option.Now
+		}
+		c.ttlJitter = option.TTLJitter
+		c.hooks = option.Hooks
+		namespace = option.Namespace
+		if option.Async != nil {
+			asyncOption = *option.Async
+		}
+		if option.Local != nil {
+			c.initLocalCache(option.Local)
+		}
+		if option.CircuitBreaker != nil {
+			c.initCircuitBreaker(*option.CircuitBreaker)
+		}
+	}
+	c.keys = NewKeyRegistry(namespace)
+	c.async = newAsyncPool(asyncOption, c.log)
+	return c
+}
+
+// Close 释放 Cache 持有的后台资源，不会关闭 Redis 客户端
+//
+// 先停止接收异步任务并等待队列中的写入完成（受 ctx 控制），再关闭一级缓存的失效订阅等资源。
+// 建议在 Kratos 应用停止时调用，例如 kratos.AfterStop
+func (c *Cache) Close(ctx context.Context) error {
+	var errs []error
+	if err := c.async.close(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, closer := range c.closers {
+		if err := closer(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logf 通过 CacheOptions.LogHelper 记录错误，未配置日志时忽略
+func (c *Cache) logf(format string, args ...interface{}) {
+	if c.log != nil {
+		c.log.Errorf(format, args...)
+	}
 }
 
 // InitCache 初始化全局 DefaultCache
-func InitCache(client redis.Cmdable) {
-	DefaultCache = NewCache(client)
+func InitCache(client redis.Cmdable, options ...CacheOptions) {
+	DefaultCache = NewCache(client, options...)
 }
 
 // SetRedis 设置缓存
-func (c *Cache) SetRedis(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	// 处理字符串类型（直接存储）
-	if str, ok := value.(string); ok {
-		return c.redis.Set(ctx, key, str, expiration).Err()
+//
+// 字符串与基本类型直接存储，其他类型使用 Cache 配置的 Codec 编码（默认JSON）；
+// 配置了 CacheOptions.TTLJitter 时过期时间会增加随机抖动
+func (c *Cache) SetRedis(ctx context.Context, key string, value interface{}, expiration time.Duration) (err error) {
+	ctx, op := c.startOp(ctx, "set", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	data, err := encodeValue(c.codec, value)
+	if err != nil {
+		return err
 	}
-	// 处理基本类型（int, float等）
-	if isBasicType(value) {
-		return c.redis.Set(ctx, key, value, expiration).Err()
+	op.addSize(data)
+	if !c.breaker.allow() {
+		c.dropLocal(key)
+		return ErrCircuitOpen
 	}
-	// 其他类型视为结构体/复杂类型，进行JSON序列化
-	data, err := json.Marshal(value)
+	err = c.redis.Set(ctx, key, data, c.jitter(expiration)).Err()
+	c.breaker.record(err)
 	if err != nil {
 		return err
 	}
-	return c.redis.Set(ctx, key, data, expiration).Err()
+	c.invalidateLocal(ctx, key)
+	return nil
 }
 
 // AsyncSetRedis 异步设置缓存
+//
+// 任务提交到有界工作池执行（见 CacheOptions.Async），临时错误会退避重试，失败时通过 logHelper 记录
 func (c *Cache) AsyncSetRedis(key string, data interface{}, expiration time.Duration, logHelper *log.Helper) {
-	go func() {
-		// 使用独立超时上下文，不影响主流程
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := c.SetRedis(ctx, key, data, expiration); err != nil && logHelper != nil {
-			logHelper.Errorf("async set redis failed for key %s: %v", key, err)
-		}
-	}()
+	c.async.submit(asyncTask{
+		name: "async set redis",
+		key:  key,
+		fn: func(ctx context.Context) error {
+			return c.SetRedis(ctx, key, data, expiration)
+		},
+		log: logHelper,
+	})
 }
 
 // GetRedis 获取缓存
 func (c *Cache) GetRedis(ctx context.Context, key string, result ...interface{}) (string, error) {
+	data, err := c.getBytes(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	// 空值缓存：记录过“数据不存在”
+	if isNotFoundSentinel(data) {
+		return "", ErrCacheNotFound
+	}
 	// 普通获取模式：不传入result则返回原始字符串
 	if len(result) == 0 {
-		return c.redis.Get(ctx, key).Result()
+		return string(data), nil
 	}
 	// 结构体获取模式：传入result指针则进行反序列化
-	data, err := c.redis.Get(ctx, key).Bytes()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return "", err
-		}
-		return "", err
-	}
-	// 反序列化到目标结构体
-	if err := json.Unmarshal(data, result[0]); err != nil {
+	if err := decodeValue(data, result[0]); err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
 
+// SetNotFound 写入空值缓存，标记 key 对应的数据不存在
+//
+// 之后 GetRedis/GetOrLoad 读取该 key 时返回 ErrCacheNotFound，直到过期或被覆盖。
+// 过期时间取 CacheOptions.NegativeTTL，未配置时使用 DefaultNegativeTTL。
+func (c *Cache) SetNotFound(ctx context.Context, key string) (err error) {
+	ctx, op := c.startOp(ctx, "set", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	if !c.breaker.allow() {
+		c.dropLocal(key)
+		return ErrCircuitOpen
+	}
+	err = c.redis.Set(ctx, key, notFoundSentinel, c.jitter(c.notFoundTTL())).Err()
+	c.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	c.invalidateLocal(ctx, key)
+	return nil
+}
+
+// notFoundTTL 返回空值缓存的过期时间
+func (c *Cache) notFoundTTL() time.Duration {
+	if c.negativeTTL > 0 {
+		return c.negativeTTL
+	}
+	return DefaultNegativeTTL
+}
+
+// isNotFoundSentinel 判断缓存数据是否为空值缓存占位值
+func isNotFoundSentinel(data []byte) bool {
+	return string(data) == notFoundSentinel
+}
+
+// defaultIsNotFound 默认的“数据不存在”错误判断
+func defaultIsNotFound(err error) bool {
+	return errors.Is(err, ErrCacheNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
+
 // DelRedis 删除单个缓存 key
-func (c *Cache) DelRedis(ctx context.Context, key string) error {
-	return c.redis.Del(ctx, key).Err()
+func (c *Cache) DelRedis(ctx context.Context, key string) (err error) {
+	ctx, op := c.startOp(ctx, "del", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	if !c.breaker.allow() {
+		c.dropLocal(key)
+		return ErrCircuitOpen
+	}
+	err = c.redis.Del(ctx, key).Err()
+	c.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	c.invalidateLocal(ctx, key)
+	return nil
 }
 
 // DelRedisMulti 删除多个缓存 key（可变参数版）
 // 便于批量删除，用于 SCAN 前缀删除等场景
-func (c *Cache) DelRedisMulti(ctx context.Context, keys ...string) error {
+func (c *Cache) DelRedisMulti(ctx context.Context, keys ...string) (err error) {
 	if len(keys) == 0 {
 		return nil
 	}
-	return c.redis.Del(ctx, keys...).Err()
+	ctx, op := c.startBatchOp(ctx, "del", keys)
+	defer func() { c.endOp(ctx, op, err) }()
+	if !c.breaker.allow() {
+		c.dropLocal(keys...)
+		return ErrCircuitOpen
+	}
+	err = c.redis.Del(ctx, keys...).Err()
+	c.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	c.invalidateLocal(ctx, keys...)
+	return nil
 }
 
 // ScanRedis 使用 Redis SCAN 按模式分页扫描 key
@@ -117,24 +302,130 @@ func (c *Cache) ScanRedis(ctx context.Context, cursor uint64, pattern string, co
 }
 
 // AsyncDelRedis 异步删除缓存
+//
+// 任务提交到有界工作池执行（见 CacheOptions.Async），临时错误会退避重试，失败时通过 logHelper 记录
 func (c *Cache) AsyncDelRedis(key string, logHelper *log.Helper) {
-	go func() {
-		// 使用独立超时上下文，不影响主流程
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := c.DelRedis(ctx, key); err != nil && logHelper != nil {
-			logHelper.Errorf("async delete redis failed for key '%s': %v", key, err)
-		}
-	}()
+	c.async.submit(asyncTask{
+		name: "async delete redis",
+		key:  key,
+		fn: func(ctx context.Context) error {
+			return c.DelRedis(ctx, key)
+		},
+		log: logHelper,
+	})
 }
 
 // TTLRefresh 刷新缓存过期时间
-func (c *Cache) TTLRefresh(ctx context.Context, key string, expiration time.Duration) error {
-	return c.redis.Expire(ctx, key, expiration).Err()
+//
+// 传入 TTLRefreshOptions.Threshold 时为滑动过期模式：仅当剩余过期时间低于阈值时才续期，
+// 避免每次访问都写 Redis；key 不存在或未设置过期时间时不处理
+func (c *Cache) TTLRefresh(ctx context.Context, key string, expiration time.Duration, options ...TTLRefreshOptions) (err error) {
+	ctx, op := c.startOp(ctx, "expire", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	if len(options) > 0 && options[0].Threshold > 0 {
+		err = slidingExpireScript.Run(ctx, c.redis, []string{key}, expiration.Milliseconds(), options[0].Threshold.Milliseconds()).Err()
+	} else {
+		err = c.redis.Expire(ctx, key, expiration).Err()
+	}
+	c.breaker.record(err)
+	return err
+}
+
+// encodeValue 按 SetRedis 的规则编码写入值
+//
+// 字符串与基本类型交给 go-redis 直接写入，其他类型使用 codec 编码
+func encodeValue(codec Codec, value interface{}) (interface{}, error) {
+	// 处理字符串类型（直接存储）
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	// 处理基本类型（int, float等）
+	if isBasicType(value) {
+		return basicValue(value), nil
+	}
+	// 其他类型视为结构体/复杂类型，使用 codec 编码（默认JSON）
+	return encodeFrame(codec, value)
+}
+
+// basicValue 将基本类型（含自定义的具名类型，如 type Status int）归一为 go-redis 可直接写入的底层类型
+func basicValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(rv.Complex(), 'g', -1, rv.Type().Bits())
+	}
+	return value
+}
+
+// decodeValue 按 SetRedis 的规则将缓存数据解码到 dst
+//
+// dst 必须为非 nil 指针；目标为字符串或基本类型时按 go-redis 的写入格式解析，
+// 其他类型按数据头部选择 Codec 解码，不带头部的历史数据按JSON反序列化
+func decodeValue(data []byte, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("decode target must be a non-nil pointer")
+	}
+	elem := rv.Elem()
+	s := string(data)
+	switch elem.Kind() {
+	case reflect.String:
+		elem.SetString(s)
+	case reflect.Bool:
+		// go-redis 将 bool 写为 "1"/"0"，同时兼容 "true"/"false"
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		elem.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v, err := strconv.ParseUint(s, 10, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetFloat(v)
+	case reflect.Complex64, reflect.Complex128:
+		v, err := strconv.ParseComplex(s, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetComplex(v)
+	default:
+		return decodeFrame(data, dst)
+	}
+	return nil
 }
 
 // 判断是否为基本数据类型（避免对基本类型进行JSON序列化）
 func isBasicType(v interface{}) bool {
+	if v == nil {
+		return false
+	}
 	kind := reflect.TypeOf(v).Kind()
 	return kind >= reflect.Bool && kind <= reflect.Complex128 ||
 		kind == reflect.String
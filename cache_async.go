@@ -0,0 +1,193 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// AsyncPolicy 异步队列已满时的处理策略
+type AsyncPolicy int
+
+const (
+	// AsyncDrop 队列已满时丢弃任务并记录日志，不阻塞调用方（默认）
+	AsyncDrop AsyncPolicy = iota
+	// AsyncBlock 队列已满时阻塞调用方，直到有空位
+	AsyncBlock
+)
+
+const (
+	defaultAsyncWorkers      = 8
+	defaultAsyncQueueSize    = 1024
+	defaultAsyncTimeout      = 5 * time.Second
+	defaultAsyncMaxRetries   = 2
+	defaultAsyncRetryBackoff = 100 * time.Millisecond
+)
+
+// ErrCacheClosed Cache 已关闭，不再接受异步任务
+var ErrCacheClosed = errors.New("cache: closed")
+
+// AsyncOptions 定义 AsyncSetRedis/AsyncDelRedis 使用的工作池参数
+type AsyncOptions struct {
+	Workers      int           // 工作协程数，默认 8
+	QueueSize    int           // 队列长度，默认 1024
+	Policy       AsyncPolicy   // 队列已满时的策略，默认 AsyncDrop
+	Timeout      time.Duration // 单次执行超时，默认 5s
+	MaxRetries   int           // 临时错误（网络、超时、LOADING 等）的最大重试次数，默认 2，小于 0 表示不重试
+	RetryBackoff time.Duration // 首次重试的退避时间，之后按指数增长，默认 100ms
+}
+
+// asyncTask 异步任务
+type asyncTask struct {
+	name string
+	key  string
+	fn   func(ctx context.Context) error
+	log  *log.Helper
+}
+
+// asyncPool 有界异步工作池，首次提交任务时才启动工作协程
+type asyncPool struct {
+	options AsyncOptions
+	log     *log.Helper
+	tasks   chan asyncTask
+	once    sync.Once
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newAsyncPool(option AsyncOptions, logHelper *log.Helper) *asyncPool {
+	if option.Workers <= 0 {
+		option.Workers = defaultAsyncWorkers
+	}
+	if option.QueueSize <= 0 {
+		option.QueueSize = defaultAsyncQueueSize
+	}
+	if option.Timeout <= 0 {
+		option.Timeout = defaultAsyncTimeout
+	}
+	if option.MaxRetries == 0 {
+		option.MaxRetries = defaultAsyncMaxRetries
+	}
+	if option.RetryBackoff <= 0 {
+		option.RetryBackoff = defaultAsyncRetryBackoff
+	}
+	return &asyncPool{options: option, log: logHelper, tasks: make(chan asyncTask, option.QueueSize)}
+}
+
+// submit 提交任务，按策略处理队列已满的情况
+func (p *asyncPool) submit(task asyncTask) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.logf(task, "%s skipped for key %s: %v", task.name, task.key, ErrCacheClosed)
+		return
+	}
+	p.once.Do(p.start)
+
+	if p.options.Policy == AsyncBlock {
+		p.tasks <- task
+		return
+	}
+	select {
+	case p.tasks <- task:
+	default:
+		p.logf(task, "%s dropped for key %s: async queue is full", task.name, task.key)
+	}
+}
+
+// close 停止接收任务并等待队列中的任务执行完毕，ctx 结束时不再等待
+func (p *asyncPool) close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *asyncPool) start() {
+	p.wg.Add(p.options.Workers)
+	for i := 0; i < p.options.Workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				p.run(task)
+			}
+		}()
+	}
+}
+
+// run 执行任务，临时错误按指数退避重试
+func (p *asyncPool) run(task asyncTask) {
+	backoff := p.options.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		// 使用独立超时上下文，不影响主流程
+		ctx, cancel := context.WithTimeout(context.Background(), p.options.Timeout)
+		err := task.fn(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= p.options.MaxRetries || !isTransientRedisError(err) {
+			p.logf(task, "%s failed for key %s: %v", task.name, task.key, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// logf 优先使用提交任务时传入的日志，其次使用 Cache 的日志
+func (p *asyncPool) logf(task asyncTask, format string, args ...interface{}) {
+	if task.log != nil {
+		task.log.Errorf(format, args...)
+		return
+	}
+	if p.log != nil {
+		p.log.Errorf(format, args...)
+	}
+}
+
+// isTransientRedisError 判断是否为可重试的临时错误
+func isTransientRedisError(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, redis.Nil), errors.Is(err, redis.ErrClosed):
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, prefix := range []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package nie_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestAsyncSetRedis_CloseDrains(t *testing.T) {
+	client, s := newTestRedis(t)
+	c := nie.NewCache(client, nie.CacheOptions{Async: &nie.AsyncOptions{Workers: 2, QueueSize: 100, Policy: nie.AsyncBlock}})
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		c.AsyncSetRedis("async:"+strings.Repeat("x", i), i, 0, nil)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if n := len(s.Keys()); n != 50 {
+		t.Fatalf("Close should drain pending writes, got %d keys", n)
+	}
+}
+
+func TestAsyncSetRedis_RetryAndDrop(t *testing.T) {
+	client, s := newTestRedis(t)
+	var buf bytes.Buffer
+	logHelper := log.NewHelper(log.NewStdLogger(&buf))
+	c := nie.NewCache(client, nie.CacheOptions{LogHelper: logHelper, Async: &nie.AsyncOptions{
+		Workers:      1,
+		QueueSize:    1,
+		MaxRetries:   5,
+		RetryBackoff: 100 * time.Millisecond,
+	}})
+	ctx := context.Background()
+
+	// 临时错误使唯一的工作协程进入退避，队列占满后新任务被丢弃
+	s.SetError("LOADING Redis is loading the dataset in memory")
+	c.AsyncSetRedis("a1", 1, 0, nil)
+	time.Sleep(50 * time.Millisecond)
+	c.AsyncSetRedis("a2", 2, 0, nil)
+	c.AsyncSetRedis("a3", 3, 0, nil)
+	s.SetError("")
+
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if !s.Exists("a1") || !s.Exists("a2") {
+		t.Fatalf("retried and queued writes should succeed, keys = %v", s.Keys())
+	}
+	if s.Exists("a3") || !strings.Contains(buf.String(), "dropped for key a3") {
+		t.Fatalf("write beyond queue size should be dropped, log = %s", buf.String())
+	}
+
+	// 关闭后提交的任务直接跳过
+	c.AsyncDelRedis("a1", nil)
+	if !s.Exists("a1") || !strings.Contains(buf.String(), "skipped for key a1") {
+		t.Fatalf("task after Close should be skipped, log = %s", buf.String())
+	}
+}
+
+func TestAsyncSetRedis_NoRetryOnCommandError(t *testing.T) {
+	client, s := newTestRedis(t)
+	var buf bytes.Buffer
+	c := nie.NewCache(client, nie.CacheOptions{Async: &nie.AsyncOptions{RetryBackoff: time.Second}})
+	ctx := context.Background()
+
+	// 命令错误不重试，使用调用方传入的日志记录
+	s.SetError("ERR boom")
+	c.AsyncSetRedis("k", 1, 0, log.NewHelper(log.NewStdLogger(&buf)))
+	start := time.Now()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if time.Since(start) >= time.Second {
+		t.Fatal("command error should not be retried")
+	}
+	if !strings.Contains(buf.String(), "failed for key k") {
+		t.Fatalf("failure should be logged, log = %s", buf.String())
+	}
+}
@@ -0,0 +1,226 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	clusterSlots  = 16384
+	mgetBatchSize = 500
+)
+
+// GetMany 批量读取缓存，返回命中的结果与未命中的 keys
+//
+// 解码规则与 GetRedis 一致。单机客户端使用 MGET，集群客户端按哈希槽拆分为多个 MGET 并通过 pipeline 一次发送，
+// 其他客户端（如 Ring）退回为 pipeline 逐个 GET。命中空值缓存的 key 既不在结果中，也不在 missing 中。
+func GetMany[T any](ctx context.Context, c *Cache, keys []string) (map[string]T, []string, error) {
+	values, found, err := c.getManyBytes(ctx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make(map[string]T, len(keys))
+	var missing []string
+	for i, data := range values {
+		if !found[i] {
+			missing = append(missing, keys[i])
+			continue
+		}
+		if isNotFoundSentinel(data) {
+			continue
+		}
+		var v T
+		if err := decodeValue(data, &v); err != nil {
+			return nil, nil, err
+		}
+		result[keys[i]] = v
+	}
+	return result, missing, nil
+}
+
+// SetMany 批量设置缓存，通过 pipeline 逐个 SET 并为每个 key 设置过期时间
+//
+// 编码规则与过期时间抖动与 SetRedis 一致；每条命令只涉及单个 key，可用于集群客户端
+func SetMany[T any](ctx context.Context, c *Cache, values map[string]T, expiration time.Duration) (err error) {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	ctx, op := c.startBatchOp(ctx, "mset", keys)
+	defer func() { c.endOp(ctx, op, err) }()
+	encoded := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if encoded[i], err = encodeValue(c.codec, values[key]); err != nil {
+			return err
+		}
+		op.addSize(encoded[i])
+	}
+	if !c.breaker.allow() {
+		c.dropLocal(keys...)
+		return ErrCircuitOpen
+	}
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			pipe.Set(ctx, key, encoded[i], c.jitter(expiration))
+		}
+		return nil
+	})
+	c.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	c.invalidateLocal(ctx, keys...)
+	return nil
+}
+
+// mget 从 Redis 批量读取，values/found 与 keys 一一对应
+//
+// withTTL[i] 为 true 时在同一 pipeline 中读取 keys[i] 的 PTTL，结果写入 ttls[i]
+func (c *Cache) mget(ctx context.Context, keys []string, withTTL []bool) (values [][]byte, found []bool, ttls []time.Duration, err error) {
+	values = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	ttls = make([]time.Duration, len(keys))
+
+	// 按客户端类型划分 MGET 分组，分组内为 keys 的下标
+	var groups [][]int
+	switch c.redis.(type) {
+	case *redis.Client:
+		groups = chunkIndexes(len(keys), nil)
+	case clusterScanner:
+		bySlot := make(map[int][]int)
+		var order []int
+		for i, key := range keys {
+			slot := hashSlot(key)
+			if _, ok := bySlot[slot]; !ok {
+				order = append(order, slot)
+			}
+			bySlot[slot] = append(bySlot[slot], i)
+		}
+		for _, slot := range order {
+			groups = append(groups, chunkIndexes(len(bySlot[slot]), bySlot[slot])...)
+		}
+	default:
+		return c.getPipelined(ctx, keys, withTTL)
+	}
+
+	cmds := make([]*redis.SliceCmd, len(groups))
+	pttls := make([]*redis.DurationCmd, len(keys))
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for g, indexes := range groups {
+			groupKeys := make([]string, len(indexes))
+			for j, i := range indexes {
+				groupKeys[j] = keys[i]
+			}
+			cmds[g] = pipe.MGet(ctx, groupKeys...)
+		}
+		for i, key := range keys {
+			if withTTL[i] {
+				pttls[i] = pipe.PTTL(ctx, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for g, indexes := range groups {
+		for j, v := range cmds[g].Val() {
+			if s, ok := v.(string); ok {
+				values[indexes[j]], found[indexes[j]] = []byte(s), true
+			}
+		}
+	}
+	for i, cmd := range pttls {
+		if cmd != nil {
+			ttls[i] = cmd.Val()
+		}
+	}
+	return values, found, ttls, nil
+}
+
+// getPipelined 使用 pipeline 逐个 GET，适用于无法确定 key 分布的客户端
+func (c *Cache) getPipelined(ctx context.Context, keys []string, withTTL []bool) (values [][]byte, found []bool, ttls []time.Duration, err error) {
+	values = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	ttls = make([]time.Duration, len(keys))
+	cmds := make([]*redis.StringCmd, len(keys))
+	pttls := make([]*redis.DurationCmd, len(keys))
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+			if withTTL[i] {
+				pttls[i] = pipe.PTTL(ctx, key)
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, nil, nil, err
+	}
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		values[i], found[i] = data, true
+		if pttls[i] != nil {
+			ttls[i] = pttls[i].Val()
+		}
+	}
+	return values, found, ttls, nil
+}
+
+// chunkIndexes 将下标按 mgetBatchSize 分块，indexes 为 nil 时表示 0..n-1
+func chunkIndexes(n int, indexes []int) [][]int {
+	if indexes == nil {
+		indexes = make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
+	var chunks [][]int
+	for len(indexes) > mgetBatchSize {
+		chunks = append(chunks, indexes[:mgetBatchSize])
+		indexes = indexes[mgetBatchSize:]
+	}
+	if len(indexes) > 0 {
+		chunks = append(chunks, indexes)
+	}
+	return chunks
+}
+
+// hashSlot 计算 key 所在的集群哈希槽，规则与 Redis Cluster 一致（CRC16 XMODEM，支持 {hashtag}）
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 CRC16-CCITT（XMODEM）
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,105 @@
+package nie_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestGetManySetMany(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	values := map[string]cacheUser{"a": {ID: 1}, "b": {ID: 2}}
+	if err := nie.SetMany(ctx, c, values, time.Minute); err != nil {
+		t.Fatalf("SetMany error: %v", err)
+	}
+	got, missing, err := nie.GetMany[cacheUser](ctx, c, []string{"a", "x", "b"})
+	if err != nil {
+		t.Fatalf("GetMany error: %v", err)
+	}
+	if len(got) != 2 || got["b"].ID != 2 {
+		t.Fatalf("unexpected hits: %+v", got)
+	}
+	if len(missing) != 1 || missing[0] != "x" {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
+
+func TestGetMany_Clients(t *testing.T) {
+	client, s := newTestRedis(t)
+	ctx := context.Background()
+
+	keys := make([]string, 1200)
+	values := make(map[string]int, len(keys)/2)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("{u%d}:k%d", i%7, i)
+		if i%2 == 0 {
+			values[keys[i]] = i
+		}
+	}
+	ring := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"a": s.Addr()}})
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{s.Addr()}})
+	t.Cleanup(func() {
+		ring.Close()
+		cluster.Close()
+	})
+	clients := map[string]redis.Cmdable{"client": client, "ring": ring, "cluster": cluster}
+
+	for name, client := range clients {
+		c := nie.NewCache(client)
+		if err := nie.SetMany(ctx, c, values, time.Minute); err != nil {
+			t.Fatalf("%s SetMany error: %v", name, err)
+		}
+		// 超过单次 MGET 上限的 key 分批读取，结果与入参顺序无关
+		got, missing, err := nie.GetMany[int](ctx, c, keys)
+		if err != nil {
+			t.Fatalf("%s GetMany error: %v", name, err)
+		}
+		if len(got) != len(values) || len(missing) != len(keys)-len(values) {
+			t.Fatalf("%s GetMany hits = %d, missing = %d", name, len(got), len(missing))
+		}
+		for key, want := range values {
+			if got[key] != want {
+				t.Fatalf("%s GetMany[%s] = %d, want %d", name, key, got[key], want)
+			}
+		}
+		s.FlushAll()
+	}
+}
+
+func TestGetMany_NegativeCacheAndTTL(t *testing.T) {
+	c, s := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{}})
+	ctx := context.Background()
+
+	if err := nie.SetMany(ctx, c, map[string]string{}, time.Minute); err != nil {
+		t.Fatalf("empty SetMany error: %v", err)
+	}
+	if err := nie.SetMany(ctx, c, map[string]string{"a": "1", "b": "2"}, time.Minute); err != nil {
+		t.Fatalf("SetMany error: %v", err)
+	}
+	if ttl := s.TTL("b"); ttl != time.Minute {
+		t.Fatalf("ttl = %v, want %v", ttl, time.Minute)
+	}
+	if err := c.SetNotFound(ctx, "nf"); err != nil {
+		t.Fatalf("SetNotFound error: %v", err)
+	}
+
+	// 第二次读取命中一级缓存
+	for i := 0; i < 2; i++ {
+		got, missing, err := nie.GetMany[string](ctx, c, []string{"a", "nf", "x", "b"})
+		if err != nil || len(got) != 2 || got["a"] != "1" || got["b"] != "2" {
+			t.Fatalf("GetMany = %v, %v", got, err)
+		}
+		if len(missing) != 1 || missing[0] != "x" {
+			t.Fatalf("missing = %v, want [x]", missing)
+		}
+	}
+	if stats := c.Stats(); stats.LocalHits != 3 {
+		t.Fatalf("LocalHits = %d, want 3", stats.LocalHits)
+	}
+}
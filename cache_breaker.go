@@ -0,0 +1,170 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen 熔断期间写入、删除或续期未执行，调用方可稍后重试或降级处理；
+// 删除失败时其他进程与 Redis 中可能仍保留旧值
+var ErrCircuitOpen = errors.New("cache: circuit breaker open")
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerProbeInterval    = 5 * time.Second
+	defaultBreakerProbeTimeout     = time.Second
+)
+
+// CircuitState 熔断器状态
+type CircuitState int32
+
+const (
+	CircuitClosed CircuitState = iota // 正常访问 Redis
+	CircuitOpen                       // 已熔断：读视为未命中，写入与删除返回 ErrCircuitOpen，后台定期探测 Redis
+)
+
+// String 返回状态名称
+func (s CircuitState) String() string {
+	if s == CircuitOpen {
+		return "open"
+	}
+	return "closed"
+}
+
+// CircuitBreakerOptions 定义 Cache 的熔断配置，通过 CacheOptions.CircuitBreaker 开启
+//
+// 连续 FailureThreshold 次连接类错误（网络错误、超时等，不含未命中与 Redis 返回的命令错误）后熔断，
+// 熔断期间 GetRedis/GetOrLoad 等读操作视为未命中（一级缓存仍可命中），SetRedis/DelRedis/InvalidateTags/DelByPattern
+// 等写入、删除与续期操作不访问 Redis，清理当前进程一级缓存后返回 ErrCircuitOpen，不再等待连接超时；
+// 后台每隔 ProbeInterval 发送 PING，成功后恢复。
+// 只作用于缓存读写，分布式锁、Stream、限流等仍直接访问 Redis
+type CircuitBreakerOptions struct {
+	FailureThreshold int                         // 触发熔断的连续失败次数，默认 5
+	ProbeInterval    time.Duration               // 熔断期间探测 Redis 的间隔，默认 5s
+	ProbeTimeout     time.Duration               // 单次探测的超时时间，默认 1s
+	OnStateChange    func(from, to CircuitState) // 状态变化回调，在探测或请求所在的 goroutine 中同步调用
+}
+
+// circuitBreaker 连续失败计数熔断器，nil 表示未开启
+type circuitBreaker struct {
+	options  CircuitBreakerOptions
+	ping     func(ctx context.Context) error
+	onChange func(from, to CircuitState)
+
+	state    atomic.Int32
+	failures atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// initCircuitBreaker 按配置创建熔断器，Close 时停止后台探测
+func (c *Cache) initCircuitBreaker(options CircuitBreakerOptions) {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if options.ProbeInterval <= 0 {
+		options.ProbeInterval = defaultBreakerProbeInterval
+	}
+	if options.ProbeTimeout <= 0 {
+		options.ProbeTimeout = defaultBreakerProbeTimeout
+	}
+	b := &circuitBreaker{
+		options: options,
+		ping: func(ctx context.Context) error {
+			return c.redis.Ping(ctx).Err()
+		},
+		done: make(chan struct{}),
+	}
+	b.onChange = func(from, to CircuitState) {
+		if to == CircuitOpen {
+			c.logf("cache circuit breaker opened after %d consecutive redis failures", options.FailureThreshold)
+		} else {
+			c.logf("cache circuit breaker closed, redis recovered")
+		}
+		if options.OnStateChange != nil {
+			options.OnStateChange(from, to)
+		}
+	}
+	c.breaker = b
+	c.closers = append(c.closers, func(context.Context) error {
+		b.closeOnce.Do(func() { close(b.done) })
+		return nil
+	})
+}
+
+// CircuitState 返回熔断器当前状态，未开启熔断时总是 CircuitClosed
+func (c *Cache) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	return CircuitState(c.breaker.state.Load())
+}
+
+// allow 熔断器未断开时返回 true，b 为 nil 时总是 true
+func (b *circuitBreaker) allow() bool {
+	return b == nil || CircuitState(b.state.Load()) == CircuitClosed
+}
+
+// record 记录一次 Redis 访问结果，连续失败达到阈值时熔断并开始探测
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	if !isConnectionError(err) {
+		b.failures.Store(0)
+		return
+	}
+	if b.failures.Add(1) < int64(b.options.FailureThreshold) {
+		return
+	}
+	if b.state.CompareAndSwap(int32(CircuitClosed), int32(CircuitOpen)) {
+		b.onChange(CircuitClosed, CircuitOpen)
+		go b.probe()
+	}
+}
+
+// probe 熔断期间定期 PING，成功后恢复
+func (b *circuitBreaker) probe() {
+	ticker := time.NewTicker(b.options.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.options.ProbeTimeout)
+		err := b.ping(ctx)
+		cancel()
+		if err == nil {
+			b.failures.Store(0)
+			b.state.Store(int32(CircuitClosed))
+			b.onChange(CircuitOpen, CircuitClosed)
+			return
+		}
+	}
+}
+
+// isConnectionError 判断错误是否表示 Redis 不可用；未命中、Redis 返回的命令错误与调用方取消不计入
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// dropLocal 熔断期间跳过写入或删除时，清理当前进程一级缓存中的旧值
+func (c *Cache) dropLocal(keys ...string) {
+	for _, key := range keys {
+		if local := c.localFor(key); local != nil {
+			local.del(key)
+		}
+	}
+}
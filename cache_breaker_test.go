@@ -0,0 +1,82 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestCache_CircuitBreaker(t *testing.T) {
+	r := nietest.NewRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: r.Server().Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	changes := make(chan nie.CircuitState, 2)
+	c := nie.NewCache(client, nie.CacheOptions{CircuitBreaker: &nie.CircuitBreakerOptions{
+		FailureThreshold: 2,
+		ProbeInterval:    10 * time.Millisecond,
+		OnStateChange:    func(_, to nie.CircuitState) { changes <- to },
+	}})
+	t.Cleanup(func() { c.Close(context.Background()) })
+	ctx := context.Background()
+
+	// 命令错误与未命中不计入失败
+	r.Server().SetError("ERR busy")
+	for i := 0; i < 3; i++ {
+		c.GetRedis(ctx, "k")
+	}
+	r.Server().SetError("")
+	if _, err := c.GetRedis(ctx, "k"); !errors.Is(err, redis.Nil) || c.CircuitState() != nie.CircuitClosed {
+		t.Fatalf("state = %s, err = %v", c.CircuitState(), err)
+	}
+
+	r.Server().Close()
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetRedis(ctx, "k"); err == nil || errors.Is(err, redis.Nil) {
+			t.Fatalf("GetRedis before open error = %v", err)
+		}
+	}
+	if to := <-changes; to != nie.CircuitOpen || c.CircuitState() != nie.CircuitOpen {
+		t.Fatalf("state = %s", to)
+	}
+
+	// 熔断期间读视为未命中，写入与删除返回 ErrCircuitOpen
+	if _, err := c.GetRedis(ctx, "k"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("GetRedis while open error = %v", err)
+	}
+	if err := c.SetRedis(ctx, "k", "v", time.Minute); !errors.Is(err, nie.ErrCircuitOpen) {
+		t.Fatalf("SetRedis while open error = %v", err)
+	}
+	if err := c.DelRedis(ctx, "k"); !errors.Is(err, nie.ErrCircuitOpen) {
+		t.Fatalf("DelRedis while open error = %v", err)
+	}
+	if _, err := c.InvalidateTags(ctx, "t"); !errors.Is(err, nie.ErrCircuitOpen) {
+		t.Fatalf("InvalidateTags while open error = %v", err)
+	}
+	if _, err := c.DelByPattern(ctx, "k*"); !errors.Is(err, nie.ErrCircuitOpen) {
+		t.Fatalf("DelByPattern while open error = %v", err)
+	}
+	loaded, err := nie.GetOrLoad(ctx, c, "user", time.Minute, func(ctx context.Context) (cacheUser, error) {
+		return cacheUser{ID: 1}, nil
+	})
+	if err != nil || loaded.ID != 1 {
+		t.Fatalf("GetOrLoad while open = %+v, %v", loaded, err)
+	}
+
+	if err := r.Server().Restart(); err != nil {
+		t.Fatalf("Restart error: %v", err)
+	}
+	if to := <-changes; to != nie.CircuitClosed {
+		t.Fatalf("state = %s", to)
+	}
+	if r.Server().Exists("k") {
+		t.Fatal("write while open should be skipped")
+	}
+	if err := c.SetRedis(ctx, "k", "v", time.Minute); err != nil || !r.Server().Exists("k") {
+		t.Fatalf("SetRedis after recovery error = %v", err)
+	}
+}
@@ -0,0 +1,441 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hashUpdateScript key 存在时才写入字段，避免只含部分字段的哈希被当作完整对象读取
+//
+// KEYS[1] 哈希 key；ARGV 为 field1, value1, field2, value2...；返回 1 表示已更新
+var hashUpdateScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("hset", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+var typeTime = reflect.TypeOf(time.Time{})
+
+// hashField 结构体字段与哈希字段的对应关系
+type hashField struct {
+	name  string // 结构体字段名，与 GetAllowFields/AllowFields 一致
+	field string // 哈希字段名，取 json 标签名，无标签时为字段名
+	index []int
+}
+
+// hashStruct 结构体的哈希字段列表
+type hashStruct struct {
+	fields []hashField
+	byName map[string]*hashField // 按结构体字段名与哈希字段名查找
+}
+
+var hashStructCache sync.Map // map[reflect.Type]*hashStruct
+
+// SetHash 将结构体按字段写入 Redis 哈希，覆盖 key 原有的全部字段
+//
+// 每个导出字段对应一个哈希字段，字段名取 json 标签名（无标签时为字段名，json:"-" 的字段忽略），
+// 匿名嵌入的结构体或结构体指针（如 BaseModel）展开为其字段，嵌入指针为 nil 时其字段不写入；哈希字段名重复时返回错误。字符串与基本类型直接存储，time.Time 按 "2006-01-02 15:04:05"
+// 格式化（零值为空字符串，与 GetTimeConverters 一致），其他类型按 SetRedis 的规则编码。
+// expiration 为 0 时不过期
+func (c *Cache) SetHash(ctx context.Context, key string, obj interface{}, expiration time.Duration) (err error) {
+	ctx, op := c.startOp(ctx, "set", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	rv, hs, err := hashStructOf(obj)
+	if err != nil {
+		return err
+	}
+	fields, _ := hs.lookup(nil)
+	if len(fields) == 0 {
+		return fmt.Errorf("cache: %s has no hash fields", rv.Type())
+	}
+	values, err := c.hashValues(rv, fields)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("cache: %s has no hash fields", rv.Type())
+	}
+	for _, v := range values {
+		op.addSize(v)
+	}
+	if !c.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, values...)
+		if expiration = c.jitter(expiration); expiration > 0 {
+			pipe.PExpire(ctx, key, expiration)
+		}
+		return nil
+	})
+	c.breaker.record(err)
+	return err
+}
+
+// GetHash 读取 SetHash 写入的哈希到结构体指针 dst
+//
+// fields 为要读取的字段，可传结构体字段名（如 AllowFields）或哈希字段名，为空时读取全部字段；
+// 未读取或哈希中不存在的字段保持原值。key 不存在时返回 redis.Nil
+func (c *Cache) GetHash(ctx context.Context, key string, dst interface{}, fields ...string) (err error) {
+	ctx, op := c.startOp(ctx, "get", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	rv, hs, err := hashStructOf(dst)
+	if err != nil {
+		return err
+	}
+	if rv.Kind() != reflect.Ptr {
+		return errors.New("cache: GetHash target must be a non-nil pointer")
+	}
+	selected, err := hs.lookup(fields)
+	if err != nil {
+		return err
+	}
+	if !c.breaker.allow() {
+		return redis.Nil
+	}
+
+	var values map[string]string
+	if len(fields) == 0 {
+		values, err = c.redis.HGetAll(ctx, key).Result()
+		c.breaker.record(err)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return redis.Nil
+		}
+	} else {
+		names := make([]string, len(selected))
+		for i, f := range selected {
+			names[i] = f.field
+		}
+		var exists *redis.IntCmd
+		var hmget *redis.SliceCmd
+		_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			exists = pipe.Exists(ctx, key)
+			hmget = pipe.HMGet(ctx, key, names...)
+			return nil
+		})
+		c.breaker.record(err)
+		if err != nil {
+			return err
+		}
+		if exists.Val() == 0 {
+			return redis.Nil
+		}
+		values = make(map[string]string, len(names))
+		for i, v := range hmget.Val() {
+			if s, ok := v.(string); ok {
+				values[names[i]] = s
+			}
+		}
+	}
+	op.hit(0, false)
+
+	elem := rv.Elem()
+	for _, f := range selected {
+		s, ok := values[f.field]
+		if !ok {
+			continue
+		}
+		op.addSize(s)
+		if err := decodeHashValue(s, hashFieldAlloc(elem, f.index)); err != nil {
+			return fmt.Errorf("cache: decode hash field %s: %w", f.field, err)
+		}
+	}
+	return nil
+}
+
+// UpdateHash 只更新 obj 中 fields 对应的哈希字段，fields 通常为请求的 AllowFields
+//
+// fields 可传结构体字段名或哈希字段名，为空时不做任何操作。
+// key 不存在时不写入（避免只有部分字段的哈希被当作完整对象读取）并返回 false，调用方应改用 SetHash 或删除缓存
+func (c *Cache) UpdateHash(ctx context.Context, key string, obj interface{}, fields ...string) (updated bool, err error) {
+	if len(fields) == 0 {
+		return false, nil
+	}
+	ctx, op := c.startOp(ctx, "set", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	rv, hs, err := hashStructOf(obj)
+	if err != nil {
+		return false, err
+	}
+	selected, err := hs.lookup(fields)
+	if err != nil {
+		return false, err
+	}
+	values, err := c.hashValues(rv, selected)
+	if err != nil {
+		return false, err
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+	for _, v := range values {
+		op.addSize(v)
+	}
+	if !c.breaker.allow() {
+		return false, ErrCircuitOpen
+	}
+	n, err := hashUpdateScript.Run(ctx, c.redis, []string{key}, values...).Int()
+	c.breaker.record(err)
+	return n == 1, err
+}
+
+// hashValues 按字段编码为 HSET 参数 field1, value1, field2, value2...，嵌入指针为 nil 的字段跳过
+func (c *Cache) hashValues(rv reflect.Value, fields []*hashField) ([]interface{}, error) {
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	values := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		fv, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		v, err := c.encodeHashValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("cache: encode hash field %s: %w", f.field, err)
+		}
+		values = append(values, f.field, v)
+	}
+	return values, nil
+}
+
+// encodeHashValue 编码单个字段，time.Time 与 *time.Time 按 GetTimeConverters 的格式处理
+func (c *Cache) encodeHashValue(v reflect.Value) (interface{}, error) {
+	switch {
+	case v.Type() == typeTime:
+		return formatHashTime(v.Interface().(time.Time)), nil
+	case v.Kind() == reflect.Ptr && v.Type().Elem() == typeTime:
+		if v.IsNil() {
+			return "", nil
+		}
+		return formatHashTime(v.Elem().Interface().(time.Time)), nil
+	}
+	return encodeValue(c.codec, v.Interface())
+}
+
+func formatHashTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layoutDateTime)
+}
+
+// decodeHashValue 将哈希字段值解码到结构体字段
+func decodeHashValue(s string, dst reflect.Value) error {
+	switch {
+	case dst.Type() == typeTime:
+		t, err := parseHashTime(s)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	case dst.Kind() == reflect.Ptr && dst.Type().Elem() == typeTime:
+		if s == "" {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		t, err := parseHashTime(s)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(&t))
+		return nil
+	}
+	return decodeValue([]byte(s), dst.Addr().Interface())
+}
+
+// parseHashTime 解析规则与 GetTimeConverters 的 string -> time.Time 一致
+func parseHashTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := parseTimeString(layoutDateTime, s); err == nil {
+		return t, nil
+	}
+	if t, err := parseTimeString(layoutDateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("日期/时间格式不正确: %s", s)
+}
+
+// hashStructOf 返回结构体（或其指针）的值与字段列表
+func hashStructOf(obj interface{}) (reflect.Value, *hashStruct, error) {
+	if obj == nil {
+		return reflect.Value{}, nil, errors.New("cache: hash struct must not be nil")
+	}
+	rv := reflect.ValueOf(obj)
+	typ := rv.Type()
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, nil, errors.New("cache: hash struct must not be nil")
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return rv, nil, fmt.Errorf("cache: hash value must be a struct, got %s", typ)
+	}
+	if hs, ok := hashStructCache.Load(typ); ok {
+		return rv, hs.(*hashStruct), nil
+	}
+	hs := newHashStruct(typ)
+	hashStructCache.Store(typ, hs)
+	return rv, hs, nil
+}
+
+// newHashStruct 解析结构体的哈希字段，规则与 encoding/json 一致：匿名嵌入且无 json 标签名的结构体或结构体指针展开
+//
+// 哈希字段名重复时取嵌入层级最浅的字段；同一层级有多个时仅有一个带 json 标签名则取该字段，否则全部忽略。
+// 按名称查找时结构体字段名优先于哈希字段名，结构体字段名重复时取层级最浅的字段
+func newHashStruct(typ reflect.Type) *hashStruct {
+	var candidates []hashCandidate
+	collectHashFields(typ, nil, map[reflect.Type]bool{typ: true}, &candidates)
+	byField := make(map[string][]int)
+	for i, f := range candidates {
+		byField[f.field] = append(byField[f.field], i)
+	}
+
+	hs := &hashStruct{byName: make(map[string]*hashField)}
+	for i, f := range candidates {
+		if dominantHashField(candidates, byField[f.field]) == i {
+			hs.fields = append(hs.fields, f.hashField)
+		}
+	}
+	for i := range hs.fields {
+		hs.byName[hs.fields[i].field] = &hs.fields[i]
+	}
+	byGoName := make(map[string]*hashField)
+	for i := range hs.fields {
+		f := &hs.fields[i]
+		if old, ok := byGoName[f.name]; !ok || len(f.index) < len(old.index) {
+			byGoName[f.name] = f
+		}
+	}
+	for name, f := range byGoName {
+		hs.byName[name] = f
+	}
+	return hs
+}
+
+// hashCandidate 展开嵌入结构体时收集的候选字段
+type hashCandidate struct {
+	hashField
+	tagged bool // 是否带 json 标签名
+}
+
+// collectHashFields 递归收集结构体字段，visiting 为当前路径上正在展开的类型，避免嵌入指针循环
+func collectHashFields(typ reflect.Type, index []int, visiting map[reflect.Type]bool, out *[]hashCandidate) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		path := append(index[:len(index):len(index)], i)
+		if sf.Anonymous && tag == "" && isStructOrPtr(sf.Type) {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				// 与 encoding/json 一致，未导出的嵌入指针无法分配，其字段忽略
+				if !sf.IsExported() {
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if !visiting[ft] {
+				visiting[ft] = true
+				collectHashFields(ft, path, visiting, out)
+				delete(visiting, ft)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = sf.Name
+		}
+		*out = append(*out, hashCandidate{hashField: hashField{name: sf.Name, field: name, index: path}, tagged: tag != ""})
+	}
+}
+
+// dominantHashField 从同名候选字段中选出生效的字段下标，存在歧义时返回 -1
+func dominantHashField(candidates []hashCandidate, indexes []int) int {
+	depth := len(candidates[indexes[0]].index)
+	for _, i := range indexes[1:] {
+		depth = min(depth, len(candidates[i].index))
+	}
+	dominant, tagged, count := -1, -1, 0
+	for _, i := range indexes {
+		if len(candidates[i].index) != depth {
+			continue
+		}
+		count++
+		dominant = i
+		if candidates[i].tagged {
+			if tagged >= 0 {
+				return -1
+			}
+			tagged = i
+		}
+	}
+	if count == 1 {
+		return dominant
+	}
+	return tagged
+}
+
+// isStructOrPtr 判断类型是否为结构体或结构体指针（time.Time 等作为普通字段存储）
+func isStructOrPtr(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && typ != typeTime
+}
+
+// hashFieldAlloc 按路径取字段，路径上为 nil 的嵌入指针会被分配
+func hashFieldAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// lookup 按名称查找字段，names 为空时返回全部字段
+func (hs *hashStruct) lookup(names []string) ([]*hashField, error) {
+	if len(names) == 0 {
+		fields := make([]*hashField, len(hs.fields))
+		for i := range hs.fields {
+			fields[i] = &hs.fields[i]
+		}
+		return fields, nil
+	}
+	fields := make([]*hashField, 0, len(names))
+	for _, name := range names {
+		f, ok := hs.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("cache: unknown hash field %q", name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
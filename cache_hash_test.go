@@ -0,0 +1,184 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+type hashUser struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Active   bool       `json:"active"`
+	Tags     []string   `json:"tags"`
+	Birthday *time.Time `json:"birthday"`
+	Secret   string     `json:"-"`
+	nie.TimeModel
+}
+
+func TestCache_Hash(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	nie.SetDefaultTimeLocation(loc)
+
+	created := time.Date(2026, 1, 19, 8, 0, 0, 0, loc)
+	u := hashUser{ID: 1, Name: "a", Active: true, Tags: []string{"x"}, Secret: "s"}
+	u.CreatedAt = created
+	if err := c.SetHash(ctx, "user:1", &u, time.Minute); err != nil {
+		t.Fatalf("SetHash error: %v", err)
+	}
+	if got := r.Server().HGet("user:1", "createTime"); got != "2026-01-19 08:00:00" {
+		t.Fatalf("createTime = %q", got)
+	}
+	if got := r.Server().HGet("user:1", "updateTime"); got != "" {
+		t.Fatalf("zero updateTime = %q", got)
+	}
+	if fields, _ := r.Server().HKeys("user:1"); len(fields) != 7 || r.Server().TTL("user:1") != time.Minute {
+		t.Fatalf("hash fields = %v, ttl = %s", fields, r.Server().TTL("user:1"))
+	}
+
+	var all hashUser
+	if err := c.GetHash(ctx, "user:1", &all); err != nil {
+		t.Fatalf("GetHash error: %v", err)
+	}
+	if all.ID != 1 || all.Name != "a" || !all.Active || len(all.Tags) != 1 || all.Birthday != nil || !all.CreatedAt.Equal(created) || all.Secret != "" {
+		t.Fatalf("GetHash = %+v", all)
+	}
+
+	// 只读取部分字段，结构体字段名与哈希字段名均可
+	partial := hashUser{ID: 9}
+	if err := c.GetHash(ctx, "user:1", &partial, "Name", "createTime"); err != nil {
+		t.Fatalf("GetHash fields error: %v", err)
+	}
+	if partial.ID != 9 || partial.Name != "a" || !partial.CreatedAt.Equal(created) {
+		t.Fatalf("GetHash fields = %+v", partial)
+	}
+
+	// 只更新 AllowFields 中的字段
+	update := hashUser{Name: "b", Active: false}
+	if ok, err := c.UpdateHash(ctx, "user:1", update, []string{"Name"}...); err != nil || !ok {
+		t.Fatalf("UpdateHash = %v, %v", ok, err)
+	}
+	var after hashUser
+	c.GetHash(ctx, "user:1", &after)
+	if after.Name != "b" || !after.Active || after.ID != 1 {
+		t.Fatalf("after UpdateHash = %+v", after)
+	}
+
+	if ok, err := c.UpdateHash(ctx, "user:2", update, "Name"); err != nil || ok {
+		t.Fatalf("UpdateHash missing key = %v, %v", ok, err)
+	}
+	if r.Server().Exists("user:2") {
+		t.Fatal("UpdateHash should not create a partial hash")
+	}
+	if err := c.GetHash(ctx, "user:2", &after, "Name"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("GetHash missing key error = %v", err)
+	}
+	if err := c.GetHash(ctx, "user:1", &after, "Unknown"); err == nil {
+		t.Fatal("unknown field should fail")
+	}
+}
+
+type HashProfile struct {
+	City string `json:"city"`
+}
+
+type hashMember struct {
+	ID int64 `json:"id"`
+	*HashProfile
+}
+
+type hashDuplicate struct {
+	Town string `json:"city"`
+	HashProfile
+}
+
+func TestCache_HashEmbeddedPointer(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+
+	// 嵌入指针展开为其字段，nil 时不写入
+	if err := c.SetHash(ctx, "member:1", hashMember{ID: 1, HashProfile: &HashProfile{City: "sz"}}, 0); err != nil {
+		t.Fatalf("SetHash error: %v", err)
+	}
+	if got := r.Server().HGet("member:1", "city"); got != "sz" {
+		t.Fatalf("city = %q", got)
+	}
+	var m hashMember
+	if err := c.GetHash(ctx, "member:1", &m, "City"); err != nil || m.HashProfile == nil || m.City != "sz" {
+		t.Fatalf("GetHash = %+v, %v", m, err)
+	}
+	if err := c.SetHash(ctx, "member:2", hashMember{ID: 2}, 0); err != nil {
+		t.Fatalf("SetHash nil embedded error: %v", err)
+	}
+	if fields, _ := r.Server().HKeys("member:2"); len(fields) != 1 || fields[0] != "id" {
+		t.Fatalf("nil embedded fields = %v", fields)
+	}
+
+	// 同名哈希字段取层级最浅的字段
+	if err := c.SetHash(ctx, "dup", hashDuplicate{Town: "gz", HashProfile: HashProfile{City: "sz"}}, 0); err != nil {
+		t.Fatalf("SetHash duplicate error: %v", err)
+	}
+	if fields, _ := r.Server().HKeys("dup"); len(fields) != 1 || r.Server().HGet("dup", "city") != "gz" {
+		t.Fatalf("duplicate fields = %v, city = %q", fields, r.Server().HGet("dup", "city"))
+	}
+}
+
+type HashBaseModel struct {
+	ID         int64 `json:"id"`
+	CreateTime int64 `json:"createTime"`
+}
+
+type HashAudit struct {
+	Operator string
+}
+
+type HashTrace struct {
+	Operator string
+}
+
+type hashOrder struct {
+	HashBaseModel
+	HashAudit
+	HashTrace
+	Created string `json:"createTime"`
+}
+
+func TestCache_HashEmbeddedOverride(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+
+	// 外层字段覆盖嵌入的 BaseModel 中同名的 createTime，同一层级冲突的 Operator 被忽略
+	order := hashOrder{
+		HashBaseModel: HashBaseModel{ID: 1, CreateTime: 100},
+		HashAudit:     HashAudit{Operator: "a"},
+		HashTrace:     HashTrace{Operator: "b"},
+		Created:       "2024-01-01",
+	}
+	if err := c.SetHash(ctx, "order:1", order, 0); err != nil {
+		t.Fatalf("SetHash error: %v", err)
+	}
+	if fields, _ := r.Server().HKeys("order:1"); len(fields) != 2 {
+		t.Fatalf("fields = %v, want id and createTime", fields)
+	}
+	if got := r.Server().HGet("order:1", "createTime"); got != "2024-01-01" {
+		t.Fatalf("createTime = %q", got)
+	}
+
+	var got hashOrder
+	if err := c.GetHash(ctx, "order:1", &got); err != nil || got.ID != 1 || got.Created != "2024-01-01" || got.CreateTime != 0 {
+		t.Fatalf("GetHash = %+v, %v", got, err)
+	}
+	if err := c.GetHash(ctx, "order:1", &got, "Operator"); err == nil {
+		t.Fatal("ambiguous field should not be addressable")
+	}
+}
@@ -0,0 +1,146 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// mixedKeyFamily 批量操作的 key 分属多个 key 族
+const mixedKeyFamily = "mixed"
+
+// CacheOp 一次 Cache 操作的观测信息，由 CacheHook 读取
+type CacheOp struct {
+	Name      string        // 操作名：get、mget、set、mset、del、expire、load
+	Key       string        // 单 key 操作的 key；批量操作为第一个 key
+	Family    string        // key 所属的 key 族（见 KeyRegistry.FamilyOf），未匹配时为空；批量操作的 key 分属多个族时为 "mixed"
+	Keys      int           // 涉及的 key 数
+	Hits      int           // 读操作命中数（含一级缓存）
+	LocalHits int           // 读操作的一级缓存命中数
+	Size      int           // 读写的负载字节数
+	Start     time.Time     // 开始时间
+	Duration  time.Duration // 耗时，OpEnd 时有效
+	Err       error         // 错误，未命中（redis.Nil）与数据不存在不视为错误
+}
+
+// Misses 返回读操作的未命中数
+func (op *CacheOp) Misses() int {
+	return op.Keys - op.Hits
+}
+
+// CacheHook 观测 Cache 操作的钩子，通过 CacheOptions.Hooks 注册
+//
+// 未注册任何钩子时 Cache 不会构造 CacheOp，也不会解析 key 族
+type CacheHook interface {
+	// OpStart 在操作开始前调用，返回的 ctx 用于后续 Redis 命令与 OpEnd，可在其中创建 span
+	OpStart(ctx context.Context, op *CacheOp) context.Context
+	// OpEnd 在操作结束后调用，多个钩子按注册的相反顺序调用
+	OpEnd(ctx context.Context, op *CacheOp)
+}
+
+// startOp 开始单 key 操作，未注册钩子时返回 nil
+func (c *Cache) startOp(ctx context.Context, name, key string) (context.Context, *CacheOp) {
+	if len(c.hooks) == 0 {
+		return ctx, nil
+	}
+	op := &CacheOp{Name: name, Key: key, Family: c.keys.FamilyOf(key), Keys: 1, Start: time.Now()}
+	return c.runOpStart(ctx, op), op
+}
+
+// startBatchOp 开始批量操作，未注册钩子时返回 nil
+func (c *Cache) startBatchOp(ctx context.Context, name string, keys []string) (context.Context, *CacheOp) {
+	if len(c.hooks) == 0 {
+		return ctx, nil
+	}
+	op := &CacheOp{Name: name, Keys: len(keys), Start: time.Now()}
+	for i, key := range keys {
+		family := c.keys.FamilyOf(key)
+		if i == 0 {
+			op.Key, op.Family = key, family
+		} else if family != op.Family {
+			op.Family = mixedKeyFamily
+			break
+		}
+	}
+	return c.runOpStart(ctx, op), op
+}
+
+func (c *Cache) runOpStart(ctx context.Context, op *CacheOp) context.Context {
+	for _, hook := range c.hooks {
+		ctx = hook.OpStart(ctx, op)
+	}
+	return ctx
+}
+
+// endOp 结束操作并调用钩子，op 为 nil 时不处理
+func (c *Cache) endOp(ctx context.Context, op *CacheOp, err error) {
+	if op == nil {
+		return
+	}
+	op.Duration = time.Since(op.Start)
+	if err != nil && !errors.Is(err, redis.Nil) && !c.isNotFound(err) {
+		op.Err = err
+	}
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		c.hooks[i].OpEnd(ctx, op)
+	}
+}
+
+// hit 记录一次命中，op 为 nil 时不处理
+func (op *CacheOp) hit(size int, local bool) {
+	if op == nil {
+		return
+	}
+	op.Hits++
+	op.Size += size
+	if local {
+		op.LocalHits++
+	}
+}
+
+// addSize 记录写入的负载大小，op 为 nil 时不处理
+func (op *CacheOp) addSize(data interface{}) {
+	if op == nil {
+		return
+	}
+	switch v := data.(type) {
+	case string:
+		op.Size += len(v)
+	case []byte:
+		op.Size += len(v)
+	}
+}
+
+// SlowLogHook 记录耗时超过阈值或失败的 Cache 操作
+type SlowLogHook struct {
+	threshold time.Duration
+	log       *log.Helper
+}
+
+// NewSlowLogHook 创建慢操作日志钩子，耗时不低于 threshold 的操作以 Warn 级别记录，失败的操作以 Error 级别记录
+func NewSlowLogHook(threshold time.Duration, logHelper *log.Helper) *SlowLogHook {
+	return &SlowLogHook{threshold: threshold, log: logHelper}
+}
+
+// OpStart 实现 CacheHook
+func (h *SlowLogHook) OpStart(ctx context.Context, _ *CacheOp) context.Context {
+	return ctx
+}
+
+// OpEnd 实现 CacheHook
+func (h *SlowLogHook) OpEnd(ctx context.Context, op *CacheOp) {
+	if h.log == nil {
+		return
+	}
+	switch {
+	case op.Err != nil:
+		h.log.WithContext(ctx).Errorf("cache %s failed: family=%s key=%s keys=%d duration=%s err=%v",
+			op.Name, op.Family, op.Key, op.Keys, op.Duration, op.Err)
+	case op.Duration >= h.threshold:
+		h.log.WithContext(ctx).Warnf("slow cache %s: family=%s key=%s keys=%d size=%d duration=%s",
+			op.Name, op.Family, op.Key, op.Keys, op.Size, op.Duration)
+	}
+}
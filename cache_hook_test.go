@@ -0,0 +1,132 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type recordHook struct {
+	mu  sync.Mutex
+	ops []nie.CacheOp
+}
+
+func (h *recordHook) OpStart(ctx context.Context, _ *nie.CacheOp) context.Context { return ctx }
+
+func (h *recordHook) OpEnd(_ context.Context, op *nie.CacheOp) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ops = append(h.ops, *op)
+}
+
+func TestCacheHook_Ops(t *testing.T) {
+	hook := &recordHook{}
+	c, _ := nietest.NewCache(t, nie.CacheOptions{Hooks: []nie.CacheHook{hook}})
+	ctx := context.Background()
+	user := c.Keys().MustDefine("user", "user:{uid}")
+
+	c.SetRedis(ctx, user.MustKey(1), cacheUser{ID: 1}, time.Minute)
+	c.GetRedis(ctx, user.MustKey(1))
+	c.GetRedis(ctx, user.MustKey(2))
+	nie.GetMany[cacheUser](ctx, c, []string{user.MustKey(1), user.MustKey(2), "other"})
+	nie.GetOrLoad(ctx, c, user.MustKey(3), time.Minute, func(ctx context.Context) (cacheUser, error) {
+		return cacheUser{}, errors.New("db down")
+	})
+
+	want := []struct {
+		name, family string
+		keys, hits   int
+		err          bool
+	}{
+		{"set", "user", 1, 0, false},
+		{"get", "user", 1, 1, false},
+		{"get", "user", 1, 0, false},
+		{"mget", "mixed", 3, 1, false},
+		{"get", "user", 1, 0, false},
+		{"load", "user", 1, 0, true},
+	}
+	if len(hook.ops) < len(want) {
+		t.Fatalf("ops = %+v", hook.ops)
+	}
+	for i, w := range want {
+		op := hook.ops[i]
+		if op.Name != w.name || op.Family != w.family || op.Keys != w.keys || op.Hits != w.hits || (op.Err != nil) != w.err {
+			t.Fatalf("op %d = %+v, want %+v", i, op, w)
+		}
+	}
+	if hook.ops[0].Size == 0 || hook.ops[1].Size != hook.ops[0].Size {
+		t.Fatalf("payload size set=%d get=%d", hook.ops[0].Size, hook.ops[1].Size)
+	}
+}
+
+func TestOTelHook(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	hook, err := nie.NewOTelHook(nie.OTelHookOptions{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	})
+	if err != nil {
+		t.Fatalf("NewOTelHook error: %v", err)
+	}
+	c, r := nietest.NewCache(t, nie.CacheOptions{Hooks: []nie.CacheHook{hook}})
+	ctx := context.Background()
+	user := c.Keys().MustDefine("user", "user:{uid}")
+
+	c.SetRedis(ctx, user.MustKey(1), cacheUser{ID: 1}, time.Minute)
+	c.GetRedis(ctx, user.MustKey(1))
+	c.GetRedis(ctx, user.MustKey(2))
+	r.Server().SetError("connection refused")
+	c.GetRedis(ctx, user.MustKey(1))
+	r.Server().SetError("")
+
+	ended := spans.Ended()
+	if len(ended) != 4 || ended[0].Name() != "cache.set" || ended[1].Name() != "cache.get" {
+		t.Fatalf("spans = %d", len(ended))
+	}
+	for _, kv := range ended[1].Attributes() {
+		if kv.Key == "cache.family" && kv.Value.AsString() != "user" {
+			t.Fatalf("span family = %s", kv.Value.AsString())
+		}
+	}
+	if ended[3].Status().Code != codes.Error {
+		t.Fatalf("failed span status = %+v", ended[3].Status())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	sums := map[string]int64{}
+	var histograms int
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				if v, ok := dp.Attributes.Value(attribute.Key("cache.family")); !ok || v.AsString() != "user" {
+					t.Fatalf("%s family = %v", m.Name, v)
+				}
+				sums[m.Name] += dp.Value
+			}
+		case metricdata.Histogram[float64], metricdata.Histogram[int64]:
+			histograms++
+		}
+	}
+	if sums["nie.cache.requests"] != 4 || sums["nie.cache.hits"] != 1 || sums["nie.cache.misses"] != 1 || sums["nie.cache.errors"] != 1 {
+		t.Fatalf("sums = %v", sums)
+	}
+	if histograms != 2 {
+		t.Fatalf("histograms = %d", histograms)
+	}
+}
@@ -0,0 +1,246 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoadOptions 定义 GetOrLoad/GetOrLoadMany 可选参数
+type LoadOptions struct {
+	Bloom       *BloomFilter  // 布隆过滤器，缓存未命中时先检查 key 是否可能存在，不存在则直接返回 ErrCacheNotFound
+	NegativeTTL time.Duration // 本次调用的空值缓存过期时间，覆盖 CacheOptions.NegativeTTL
+
+	// EarlyRefreshBeta XFetch 概率提前刷新系数 β，大于 0 时开启（通常取 1，越大越早刷新），仅 GetOrLoad 支持。
+	// 命中时按剩余过期时间计算概率，触发后在后台重新加载并回写，本次仍返回当前缓存值
+	EarlyRefreshBeta  float64
+	EarlyRefreshDelta time.Duration // 预估的 loader 耗时 δ，默认 1s
+}
+
+// GetOrLoad 旁路缓存读取
+//
+// 先读取缓存，命中时直接解码为 T；未命中时调用 loader 加载数据，并按 expiration 回写缓存。
+// 同一进程内对同一 key 的并发未命中只会执行一次 loader，其余调用方共享结果。
+// 编码规则与 SetRedis 一致，旧代码写入的缓存可以直接读取。
+//
+// loader 运行在不随调用方取消的上下文中，避免首个调用方取消导致其他等待方一起失败；
+// 调用方自身的 ctx 取消时会立即返回 ctx.Err()。回写失败不影响返回结果，仅记录日志。
+//
+// 防穿透：命中空值缓存，或布隆过滤器判定 key 不存在时返回 ErrCacheNotFound；
+// 启用空值缓存（NegativeTTL > 0）时，loader 返回“数据不存在”错误会写入空值缓存并返回 ErrCacheNotFound，
+// 未启用时原样返回 loader 的错误。
+//
+// 防雪崩：回写遵循 CacheOptions.TTLJitter；LoadOptions.EarlyRefreshBeta 开启 XFetch 概率提前刷新。
+func GetOrLoad[T any](ctx context.Context, c *Cache, key string, expiration time.Duration, loader func(ctx context.Context) (T, error), options ...LoadOptions) (T, error) {
+	var zero T
+	option := c.loadOptions(options)
+	load := func(ctx context.Context) (interface{}, error) {
+		ctx, op := c.startOp(ctx, "load", key)
+		v, err := loader(ctx)
+		c.endOp(ctx, op, err)
+		if err != nil {
+			if option.NegativeTTL > 0 && c.isNotFound(err) {
+				c.writeNotFound(ctx, option.NegativeTTL, key)
+				return nil, ErrCacheNotFound
+			}
+			return nil, err
+		}
+		if err := c.SetRedis(ctx, key, v, expiration); err != nil && !errors.Is(err, ErrCircuitOpen) {
+			c.logf("write back cache failed for key %s: %v", key, err)
+		}
+		return v, nil
+	}
+
+	var data []byte
+	var ttl time.Duration
+	var err error
+	if option.EarlyRefreshBeta > 0 {
+		data, ttl, err = c.getWithTTL(ctx, key)
+	} else {
+		data, err = c.getBytes(ctx, key)
+	}
+	if err == nil {
+		if isNotFoundSentinel(data) {
+			return zero, ErrCacheNotFound
+		}
+		var v T
+		if err := decodeValue(data, &v); err != nil {
+			return zero, err
+		}
+		if shouldRefreshEarly(ttl, option.EarlyRefreshDelta, option.EarlyRefreshBeta) {
+			go func() {
+				_, err := c.load(context.WithoutCancel(ctx), loadKey[T](key), load)
+				if err != nil && !c.isNotFound(err) {
+					c.logf("early refresh failed for key %s: %v", key, err)
+				}
+			}()
+		}
+		return v, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return zero, err
+	}
+	if !c.mayExist(ctx, option.Bloom, key) {
+		return zero, ErrCacheNotFound
+	}
+
+	val, err := c.load(ctx, loadKey[T](key), load)
+	if err != nil {
+		return zero, err
+	}
+	if val == nil {
+		return zero, nil
+	}
+	v, ok := val.(T)
+	if !ok {
+		return zero, fmt.Errorf("cache: load %s got %T, want %s", key, val, reflect.TypeFor[T]())
+	}
+	return v, nil
+}
+
+// GetOrLoadMany 批量旁路缓存读取
+//
+// 使用 GetMany 的方式一次读取全部 keys，对未命中的 keys 调用一次 loader 批量加载并回写缓存。
+// loader 返回结果中不存在的 key 视为数据不存在，不会出现在返回值中；启用空值缓存时会为这些 key 写入空值缓存。
+// 命中空值缓存或被布隆过滤器拦截的 key 同样不会出现在返回值中。
+// 同一进程内未命中 key 集合完全相同的并发调用只会执行一次 loader。
+func GetOrLoadMany[T any](ctx context.Context, c *Cache, keys []string, expiration time.Duration, loader func(ctx context.Context, missing []string) (map[string]T, error), options ...LoadOptions) (map[string]T, error) {
+	result := make(map[string]T, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	option := c.loadOptions(options)
+
+	values, found, err := c.getManyBytes(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for i, data := range values {
+		if !found[i] {
+			if c.mayExist(ctx, option.Bloom, keys[i]) {
+				missing = append(missing, keys[i])
+			}
+			continue
+		}
+		if isNotFoundSentinel(data) {
+			continue
+		}
+		var v T
+		if err := decodeValue(data, &v); err != nil {
+			return nil, err
+		}
+		result[keys[i]] = v
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	sort.Strings(missing)
+	val, err := c.load(ctx, loadKey[map[string]T]("\x00many\x00"+strings.Join(missing, "\x00")), func(ctx context.Context) (interface{}, error) {
+		ctx, op := c.startBatchOp(ctx, "load", missing)
+		loaded, err := loader(ctx, missing)
+		c.endOp(ctx, op, err)
+		if err != nil {
+			return nil, err
+		}
+		if err := SetMany(ctx, c, loaded, expiration); err != nil && !errors.Is(err, ErrCircuitOpen) {
+			c.logf("write back cache failed for %d keys: %v", len(loaded), err)
+		}
+		var notFound []string
+		for _, key := range missing {
+			if _, ok := loaded[key]; !ok {
+				notFound = append(notFound, key)
+			}
+		}
+		c.writeNotFound(ctx, option.NegativeTTL, notFound...)
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	loaded, ok := val.(map[string]T)
+	if !ok {
+		return nil, fmt.Errorf("cache: load %d keys got %T, want map[string]%s", len(missing), val, reflect.TypeFor[T]())
+	}
+	for key, v := range loaded {
+		result[key] = v
+	}
+	return result, nil
+}
+
+// loadOptions 合并 LoadOptions 与 Cache 级别配置
+func (c *Cache) loadOptions(options []LoadOptions) LoadOptions {
+	var option LoadOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.NegativeTTL <= 0 {
+		option.NegativeTTL = c.negativeTTL
+	}
+	return option
+}
+
+// mayExist 使用布隆过滤器判断 key 是否可能存在
+//
+// 未配置布隆过滤器或过滤器读取失败时放行（返回 true），由 loader 兜底
+func (c *Cache) mayExist(ctx context.Context, bloom *BloomFilter, key string) bool {
+	if bloom == nil {
+		return true
+	}
+	ok, err := bloom.Exists(ctx, key)
+	if err != nil {
+		c.logf("bloom filter check failed for key %s: %v", key, err)
+		return true
+	}
+	return ok
+}
+
+// writeNotFound 为不存在的数据写入空值缓存，negativeTTL 不大于 0 时不写入
+func (c *Cache) writeNotFound(ctx context.Context, negativeTTL time.Duration, keys ...string) {
+	if negativeTTL <= 0 || len(keys) == 0 {
+		return
+	}
+	if !c.breaker.allow() {
+		c.dropLocal(keys...)
+		return
+	}
+	_, err := c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Set(ctx, key, notFoundSentinel, c.jitter(negativeTTL))
+		}
+		return nil
+	})
+	c.breaker.record(err)
+	if err != nil {
+		c.logf("write negative cache failed for %d keys: %v", len(keys), err)
+		return
+	}
+	c.invalidateLocal(ctx, keys...)
+}
+
+// loadKey 返回 singleflight key，包含结果类型，避免以不同 T 加载同一 key 的调用方共享结果
+func loadKey[T any](key string) string {
+	return reflect.TypeFor[T]().String() + "\x00" + key
+}
+
+// load 使用 singleflight 合并同一 key 的并发加载
+func (c *Cache) load(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	loadCtx := context.WithoutCancel(ctx)
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		return fn(loadCtx)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		return res.Val, res.Err
+	}
+}
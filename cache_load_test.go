@@ -0,0 +1,272 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+	"gorm.io/gorm"
+)
+
+func TestGetOrLoad_SingleflightAndWriteBack(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (*cacheUser, error) {
+		calls.Add(1)
+		<-release
+		return &cacheUser{ID: 7, Name: "loaded"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*cacheUser, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, err := nie.GetOrLoad(ctx, c, "user:7", time.Minute, loader)
+			if err != nil {
+				t.Errorf("GetOrLoad error: %v", err)
+			}
+			results[i] = u
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	for _, u := range results {
+		if u == nil || u.Name != "loaded" {
+			t.Fatalf("unexpected result: %+v", u)
+		}
+	}
+	if ttl := s.TTL("user:7"); ttl != time.Minute {
+		t.Fatalf("write back ttl = %v, want %v", ttl, time.Minute)
+	}
+
+	u, err := nie.GetOrLoad(ctx, c, "user:7", time.Minute, func(ctx context.Context) (*cacheUser, error) {
+		t.Fatal("loader should not be called on cache hit")
+		return nil, nil
+	})
+	if err != nil || u.ID != 7 {
+		t.Fatalf("GetOrLoad hit = %+v, %v", u, err)
+	}
+}
+
+func TestGetOrLoad_CallerCanceled(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 调用方取消后 loader 继续执行并回写缓存
+		_, err := nie.GetOrLoad(ctx, c, "slow", time.Minute, func(ctx context.Context) (string, error) {
+			cancel()
+			<-release
+			return "v", ctx.Err()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetOrLoad error = %v, want context.Canceled", err)
+		}
+	}()
+	<-done
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for !s.Exists("slow") {
+		if time.Now().After(deadline) {
+			t.Fatal("loader result was not written back after caller canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetOrLoadMany(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "u:1", cacheUser{ID: 1}, 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	var loaded []string
+	loader := func(ctx context.Context, missing []string) (map[string]cacheUser, error) {
+		loaded = append(loaded, missing...)
+		return map[string]cacheUser{"u:2": {ID: 2}}, nil
+	}
+	got, err := nie.GetOrLoadMany(ctx, c, []string{"u:3", "u:1", "u:2"}, time.Minute, loader)
+	if err != nil {
+		t.Fatalf("GetOrLoadMany error: %v", err)
+	}
+	if len(got) != 2 || got["u:1"].ID != 1 || got["u:2"].ID != 2 {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+	if strings.Join(loaded, ",") != "u:2,u:3" {
+		t.Fatalf("loader got %v, want [u:2 u:3]", loaded)
+	}
+
+	// 已回写的 key 命中缓存，loader 未返回的 key 仍视为未命中
+	loaded = nil
+	got, err = nie.GetOrLoadMany(ctx, c, []string{"u:1", "u:2", "u:3"}, time.Minute, loader)
+	if err != nil || len(got) != 2 || strings.Join(loaded, ",") != "u:3" {
+		t.Fatalf("second call = %+v, loaded %v, err %v", got, loaded, err)
+	}
+}
+
+func TestGetOrLoad_NegativeCache(t *testing.T) {
+	c, s := newTestCache(t, nie.CacheOptions{NegativeTTL: 30 * time.Second})
+	ctx := context.Background()
+
+	var calls int
+	loader := func(ctx context.Context) (cacheUser, error) {
+		calls++
+		return cacheUser{}, gorm.ErrRecordNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := nie.GetOrLoad(ctx, c, "user:404", time.Minute, loader); !errors.Is(err, nie.ErrCacheNotFound) {
+			t.Fatalf("GetOrLoad error = %v, want ErrCacheNotFound", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times, want 1", calls)
+	}
+	var u cacheUser
+	if _, err := c.GetRedis(ctx, "user:404", &u); !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetRedis error = %v, want ErrCacheNotFound", err)
+	}
+
+	s.FastForward(30 * time.Second)
+	if _, err := nie.GetOrLoad(ctx, c, "user:404", time.Minute, loader); !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetOrLoad error = %v, want ErrCacheNotFound", err)
+	}
+	if calls != 2 {
+		t.Fatalf("loader should run again after negative TTL, calls = %d", calls)
+	}
+}
+
+func TestGetOrLoad_NotFoundWithoutNegativeCache(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	_, err := nie.GetOrLoad(ctx, c, "user:404", time.Minute, func(ctx context.Context) (cacheUser, error) {
+		return cacheUser{}, gorm.ErrRecordNotFound
+	})
+	if !errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetOrLoad error = %v, want loader error", err)
+	}
+	if _, err := c.GetRedis(ctx, "user:404"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("negative cache should not be written, got %v", err)
+	}
+}
+
+func TestGetOrLoad_ConcurrentDifferentTypes(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		v, err := nie.GetOrLoad(ctx, c, "k", time.Minute, func(ctx context.Context) (int, error) {
+			<-release
+			return 1, nil
+		})
+		if err != nil || v != 1 {
+			t.Errorf("int GetOrLoad = %d, %v", v, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		v, err := nie.GetOrLoad(ctx, c, "k", time.Minute, func(ctx context.Context) (string, error) {
+			<-release
+			return "s", nil
+		})
+		if err != nil || v != "s" {
+			t.Errorf("string GetOrLoad = %q, %v", v, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		v, err := nie.GetOrLoadMany(ctx, c, []string{"m"}, time.Minute, func(ctx context.Context, missing []string) (map[string]int, error) {
+			<-release
+			return map[string]int{"m": 1}, nil
+		})
+		if err != nil || v["m"] != 1 {
+			t.Errorf("int GetOrLoadMany = %v, %v", v, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		v, err := nie.GetOrLoadMany(ctx, c, []string{"m"}, time.Minute, func(ctx context.Context, missing []string) (map[string]string, error) {
+			<-release
+			return map[string]string{"m": "s"}, nil
+		})
+		if err != nil || v["m"] != "s" {
+			t.Errorf("string GetOrLoadMany = %v, %v", v, err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestGetOrLoad_CustomIsNotFound(t *testing.T) {
+	errMissing := errors.New("missing")
+	c, _ := newTestCache(t, nie.CacheOptions{
+		NegativeTTL: time.Minute,
+		IsNotFound:  func(err error) bool { return errors.Is(err, errMissing) },
+	})
+	ctx := context.Background()
+
+	var calls int
+	loader := func(ctx context.Context) (string, error) {
+		calls++
+		return "", errMissing
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := nie.GetOrLoad(ctx, c, "k", time.Minute, loader); !errors.Is(err, nie.ErrCacheNotFound) {
+			t.Fatalf("GetOrLoad error = %v, want ErrCacheNotFound", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times, want 1", calls)
+	}
+}
+
+func TestGetOrLoadMany_NegativeCache(t *testing.T) {
+	c, _ := newTestCache(t, nie.CacheOptions{NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	var loaded []string
+	loader := func(ctx context.Context, missing []string) (map[string]cacheUser, error) {
+		loaded = append(loaded, missing...)
+		return map[string]cacheUser{"u:2": {ID: 2}}, nil
+	}
+	got, err := nie.GetOrLoadMany(ctx, c, []string{"u:2", "u:3"}, time.Minute, loader)
+	if err != nil || len(got) != 1 || got["u:2"].ID != 2 {
+		t.Fatalf("GetOrLoadMany = %+v, %v", got, err)
+	}
+
+	// loader 未返回的 key 写入空值缓存，再次读取不会调用 loader
+	loaded = nil
+	got, err = nie.GetOrLoadMany(ctx, c, []string{"u:2", "u:3"}, time.Minute, loader)
+	if err != nil || len(got) != 1 || len(loaded) != 0 {
+		t.Fatalf("second call should be served from cache, got %+v, loaded %v, err %v", got, loaded, err)
+	}
+	if _, err := c.GetRedis(ctx, "u:3"); !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetRedis error = %v, want ErrCacheNotFound", err)
+	}
+}
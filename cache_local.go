@@ -0,0 +1,261 @@
+package nie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultLocalCacheSize    = 10000
+	defaultLocalCacheTTL     = time.Minute
+	defaultLocalCacheChannel = "nie:cache:invalidate"
+)
+
+// LocalCacheOptions 定义进程内一级缓存（L1）可选参数
+//
+// 开启后 GetRedis/GetOrLoad 等读操作优先读取进程内 LRU，未命中再读 Redis 并回填；
+// SetRedis/DelRedis/DelRedisMulti 等写操作会删除本地条目，并通过 Redis 发布订阅通知其他副本删除。
+// 订阅需要客户端支持 Subscribe（*redis.Client、*redis.ClusterClient 等），否则仅依赖 TTL 兜底。
+type LocalCacheOptions struct {
+	Size     int           // 最大条目数，默认 10000
+	TTL      time.Duration // 条目过期时间上限，默认 1 分钟，也是跨副本不一致的最长时间；不会超过 key 在 Redis 中的剩余过期时间
+	Channel  string        // 失效通知频道，默认 "nie:cache:invalidate"
+	Prefixes []string      // 仅缓存这些前缀的 key，为空表示全部 key
+}
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	LocalHits    uint64 // 一级缓存命中次数
+	LocalMisses  uint64 // 一级缓存未命中次数
+	RedisHits    uint64 // Redis 命中次数
+	RedisMisses  uint64 // Redis 未命中次数
+	LocalEntries int    // 一级缓存当前条目数
+}
+
+// cacheStats 命中计数器，Cache 的副本之间共享
+type cacheStats struct {
+	localHits   atomic.Uint64
+	localMisses atomic.Uint64
+	redisHits   atomic.Uint64
+	redisMisses atomic.Uint64
+}
+
+// subscriber 支持发布订阅的 Redis 客户端
+type subscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// Stats 返回各层缓存的命中统计
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{
+		LocalHits:   c.stats.localHits.Load(),
+		LocalMisses: c.stats.localMisses.Load(),
+		RedisHits:   c.stats.redisHits.Load(),
+		RedisMisses: c.stats.redisMisses.Load(),
+	}
+	if c.local != nil {
+		stats.LocalEntries = c.local.len()
+	}
+	return stats
+}
+
+// initLocalCache 根据配置开启一级缓存并订阅失效通知
+func (c *Cache) initLocalCache(option *LocalCacheOptions) {
+	size := option.Size
+	if size <= 0 {
+		size = defaultLocalCacheSize
+	}
+	ttl := option.TTL
+	if ttl <= 0 {
+		ttl = defaultLocalCacheTTL
+	}
+	c.localChannel = option.Channel
+	if c.localChannel == "" {
+		c.localChannel = defaultLocalCacheChannel
+	}
+	c.localPrefixes = option.Prefixes
+	c.local = newLocalCache(size, ttl, c.now)
+
+	sub, ok := c.redis.(subscriber)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := sub.Subscribe(ctx, c.localChannel)
+	c.closers = append(c.closers, func(context.Context) error {
+		cancel()
+		return pubsub.Close()
+	})
+	go c.receiveInvalidation(pubsub)
+}
+
+// receiveInvalidation 处理失效通知，直到订阅关闭
+func (c *Cache) receiveInvalidation(pubsub *redis.PubSub) {
+	for msg := range pubsub.ChannelWithSubscriptions() {
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// （重新）订阅成功：断线期间可能丢失通知，清空本地缓存保证一致
+			if m.Kind == "subscribe" {
+				c.local.purge()
+			}
+		case *redis.Message:
+			var keys []string
+			if err := json.Unmarshal([]byte(m.Payload), &keys); err != nil {
+				c.logf("decode cache invalidation message failed: %v", err)
+				continue
+			}
+			c.local.del(keys...)
+		}
+	}
+}
+
+// localFor 返回 key 可使用的一级缓存，未开启或不在缓存前缀内时返回 nil
+func (c *Cache) localFor(key string) *localCache {
+	if c.local == nil {
+		return nil
+	}
+	if len(c.localPrefixes) == 0 {
+		return c.local
+	}
+	for _, prefix := range c.localPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return c.local
+		}
+	}
+	return nil
+}
+
+// invalidateLocal 删除本地条目并通知其他副本，通知失败仅记录日志（由 TTL 兜底）
+func (c *Cache) invalidateLocal(ctx context.Context, keys ...string) {
+	if c.local == nil {
+		return
+	}
+	var localKeys []string
+	for _, key := range keys {
+		if c.localFor(key) != nil {
+			localKeys = append(localKeys, key)
+		}
+	}
+	if len(localKeys) == 0 {
+		return
+	}
+	c.local.del(localKeys...)
+
+	payload, err := json.Marshal(localKeys)
+	if err == nil {
+		err = c.redis.Publish(ctx, c.localChannel, payload).Err()
+	}
+	if err != nil {
+		c.logf("publish cache invalidation failed for %d keys: %v", len(localKeys), err)
+	}
+}
+
+// getBytes 依次读取一级缓存与 Redis，Redis 命中时回填一级缓存
+//
+// 回填时在同一 pipeline 中读取 PTTL，一级缓存条目不会晚于 Redis 中的 key 过期。未命中返回 redis.Nil；空值缓存占位值原样返回，由调用方判断
+func (c *Cache) getBytes(ctx context.Context, key string) (data []byte, err error) {
+	ctx, op := c.startOp(ctx, "get", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	local := c.localFor(key)
+	if local != nil {
+		if data, ok := local.get(key); ok {
+			c.stats.localHits.Add(1)
+			op.hit(len(data), true)
+			return data, nil
+		}
+		c.stats.localMisses.Add(1)
+	}
+	if !c.breaker.allow() {
+		c.stats.redisMisses.Add(1)
+		return nil, redis.Nil
+	}
+	if local == nil {
+		data, err = c.redis.Get(ctx, key).Bytes()
+		c.breaker.record(err)
+	} else {
+		var get *redis.StringCmd
+		var pttl *redis.DurationCmd
+		_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, key)
+			pttl = pipe.PTTL(ctx, key)
+			return nil
+		})
+		c.breaker.record(err)
+		if err == nil || errors.Is(err, redis.Nil) {
+			data, err = get.Bytes()
+		}
+		if err == nil {
+			local.set(key, data, pttl.Val())
+		}
+	}
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			c.stats.redisMisses.Add(1)
+		}
+		return nil, err
+	}
+	c.stats.redisHits.Add(1)
+	op.hit(len(data), false)
+	return data, nil
+}
+
+// getManyBytes 批量读取，返回值与 keys 一一对应，found[i] 表示 keys[i] 是否命中
+//
+// 一级缓存未命中的 key 通过 MGET 批量读取 Redis，需要回填一级缓存的 key 同时读取 PTTL
+func (c *Cache) getManyBytes(ctx context.Context, keys []string) (values [][]byte, found []bool, err error) {
+	ctx, op := c.startBatchOp(ctx, "mget", keys)
+	defer func() { c.endOp(ctx, op, err) }()
+	values = make([][]byte, len(keys))
+	found = make([]bool, len(keys))
+	var pending []int
+	for i, key := range keys {
+		if local := c.localFor(key); local != nil {
+			if data, ok := local.get(key); ok {
+				c.stats.localHits.Add(1)
+				op.hit(len(data), true)
+				values[i], found[i] = data, true
+				continue
+			}
+			c.stats.localMisses.Add(1)
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return values, found, nil
+	}
+	if !c.breaker.allow() {
+		c.stats.redisMisses.Add(uint64(len(pending)))
+		return values, found, nil
+	}
+
+	pendingKeys := make([]string, len(pending))
+	withTTL := make([]bool, len(pending))
+	for j, i := range pending {
+		pendingKeys[j] = keys[i]
+		withTTL[j] = c.localFor(keys[i]) != nil
+	}
+	fetched, fetchedFound, ttls, err := c.mget(ctx, pendingKeys, withTTL)
+	c.breaker.record(err)
+	if err != nil {
+		return nil, nil, err
+	}
+	for j, i := range pending {
+		if !fetchedFound[j] {
+			c.stats.redisMisses.Add(1)
+			continue
+		}
+		c.stats.redisHits.Add(1)
+		op.hit(len(fetched[j]), false)
+		values[i], found[i] = fetched[j], true
+		if local := c.localFor(keys[i]); local != nil {
+			local.set(keys[i], fetched[j], ttls[j])
+		}
+	}
+	return values, found, nil
+}
@@ -0,0 +1,160 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+)
+
+// testClock 可手动推进的时钟，用作 CacheOptions.Now
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestLocalCache_Invalidation(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+	local := &nie.LocalCacheOptions{Size: 10, TTL: time.Minute}
+	a := nie.NewCache(client, nie.CacheOptions{Local: local})
+	b := nie.NewCache(client, nie.CacheOptions{Local: local})
+	t.Cleanup(func() {
+		_ = a.Close(ctx)
+		_ = b.Close(ctx)
+	})
+	// 等待订阅建立
+	time.Sleep(50 * time.Millisecond)
+
+	if err := b.SetRedis(ctx, "dict:1", "v1", 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := a.GetRedis(ctx, "dict:1"); err != nil || v != "v1" {
+			t.Fatalf("GetRedis = %q, %v", v, err)
+		}
+	}
+	if stats := a.Stats(); stats.LocalHits != 1 || stats.RedisHits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if err := b.SetRedis(ctx, "dict:1", "v2", 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		v, err := a.GetRedis(ctx, "dict:1")
+		if err == nil && v == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("local entry was not invalidated, got %q, %v", v, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalCache_CapacityAndTTL(t *testing.T) {
+	clock := newTestClock()
+	c, s := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{Size: 2, TTL: time.Minute}, Now: clock.Now})
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		s.Set(key, key)
+		if v, err := c.GetRedis(ctx, key); err != nil || v != key {
+			t.Fatalf("GetRedis(%s) = %q, %v", key, v, err)
+		}
+	}
+	if n := c.Stats().LocalEntries; n != 2 {
+		t.Fatalf("LocalEntries = %d, want 2", n)
+	}
+
+	// 绕过 Cache 直接修改 Redis 不会发出通知，本地条目在 TTL 内保持旧值
+	s.Set("c", "c2")
+	if v, _ := c.GetRedis(ctx, "c"); v != "c" {
+		t.Fatalf("GetRedis before local TTL = %q, want c", v)
+	}
+	clock.Advance(time.Minute)
+	if v, _ := c.GetRedis(ctx, "c"); v != "c2" {
+		t.Fatalf("GetRedis after local TTL = %q, want c2", v)
+	}
+	// 被淘汰的 a 重新从 Redis 读取
+	before := c.Stats()
+	if _, err := c.GetRedis(ctx, "a"); err != nil {
+		t.Fatalf("GetRedis error: %v", err)
+	}
+	if after := c.Stats(); after.LocalMisses != before.LocalMisses+1 || after.RedisHits != before.RedisHits+1 {
+		t.Fatalf("evicted key should miss locally, stats %+v -> %+v", before, after)
+	}
+}
+
+func TestLocalCache_CappedByRedisTTL(t *testing.T) {
+	clock := newTestClock()
+	c, s := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{TTL: time.Minute}, Now: clock.Now})
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "short", "v", 5*time.Second); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	if err := c.SetRedis(ctx, "batch", "v", 5*time.Second); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	if v, err := c.GetRedis(ctx, "short"); err != nil || v != "v" {
+		t.Fatalf("GetRedis = %q, %v", v, err)
+	}
+	if found, _, err := nie.GetMany[string](ctx, c, []string{"batch"}); err != nil || found["batch"] != "v" {
+		t.Fatalf("GetMany = %v, %v", found, err)
+	}
+	if n := c.Stats().LocalEntries; n != 2 {
+		t.Fatalf("LocalEntries = %d, want 2", n)
+	}
+
+	// Redis 中的 key 已过期，一级缓存不应继续返回旧值
+	s.FastForward(6 * time.Second)
+	clock.Advance(6 * time.Second)
+	if _, err := c.GetRedis(ctx, "short"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("GetRedis after redis expiry error = %v, want redis.Nil", err)
+	}
+	if found, missing, err := nie.GetMany[string](ctx, c, []string{"batch"}); err != nil || len(found) != 0 || len(missing) != 1 {
+		t.Fatalf("GetMany after redis expiry = %v, %v, %v", found, missing, err)
+	}
+}
+
+func TestLocalCache_Prefixes(t *testing.T) {
+	c, s := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{Prefixes: []string{"dict:"}}})
+	ctx := context.Background()
+
+	s.Set("dict:1", "d")
+	s.Set("user:1", "u")
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetRedis(ctx, "dict:1"); err != nil {
+			t.Fatalf("GetRedis error: %v", err)
+		}
+		if _, err := c.GetRedis(ctx, "user:1"); err != nil {
+			t.Fatalf("GetRedis error: %v", err)
+		}
+	}
+	if stats := c.Stats(); stats.LocalHits != 1 || stats.RedisHits != 3 || stats.LocalEntries != 1 {
+		t.Fatalf("only prefixed keys should be cached locally, stats %+v", stats)
+	}
+}
@@ -0,0 +1,143 @@
+package nie
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	otelInstrumentationName = "github.com/sca-rab/nie-go"
+	otelOtherFamily         = "other"
+)
+
+// OTelHookOptions 定义 OTelHook 可选参数
+type OTelHookOptions struct {
+	TracerProvider trace.TracerProvider // 默认 otel.GetTracerProvider()
+	MeterProvider  metric.MeterProvider // 默认 otel.GetMeterProvider()
+}
+
+// OTelHook 基于 OpenTelemetry 的 CacheHook，为每次操作创建 span 并记录指标
+//
+// 指标与 span 属性只使用 key 族（cache.family），不包含完整 key，未注册到 KeyRegistry 的 key 记为 "other"。指标：
+//   - nie.cache.requests  操作次数
+//   - nie.cache.hits      命中 key 数，layer 区分 local（一级缓存）与 redis
+//   - nie.cache.misses    未命中 key 数，仅读操作
+//   - nie.cache.errors    失败次数
+//   - nie.cache.duration  耗时直方图（秒）
+//   - nie.cache.payload.size 负载大小直方图（字节）
+type OTelHook struct {
+	tracer   trace.Tracer
+	requests metric.Int64Counter
+	hits     metric.Int64Counter
+	misses   metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+	size     metric.Int64Histogram
+}
+
+// NewOTelHook 创建 OpenTelemetry 钩子
+func NewOTelHook(options ...OTelHookOptions) (*OTelHook, error) {
+	var option OTelHookOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.TracerProvider == nil {
+		option.TracerProvider = otel.GetTracerProvider()
+	}
+	if option.MeterProvider == nil {
+		option.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := option.MeterProvider.Meter(otelInstrumentationName)
+	h := &OTelHook{tracer: option.TracerProvider.Tracer(otelInstrumentationName)}
+	var err error
+	if h.requests, err = meter.Int64Counter("nie.cache.requests", metric.WithDescription("Number of cache operations")); err != nil {
+		return nil, err
+	}
+	if h.hits, err = meter.Int64Counter("nie.cache.hits", metric.WithDescription("Number of cache hits")); err != nil {
+		return nil, err
+	}
+	if h.misses, err = meter.Int64Counter("nie.cache.misses", metric.WithDescription("Number of cache misses")); err != nil {
+		return nil, err
+	}
+	if h.errors, err = meter.Int64Counter("nie.cache.errors", metric.WithDescription("Number of failed cache operations")); err != nil {
+		return nil, err
+	}
+	if h.duration, err = meter.Float64Histogram("nie.cache.duration", metric.WithUnit("s"), metric.WithDescription("Duration of cache operations")); err != nil {
+		return nil, err
+	}
+	if h.size, err = meter.Int64Histogram("nie.cache.payload.size", metric.WithUnit("By"), metric.WithDescription("Payload size of cache operations")); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// OpStart 实现 CacheHook
+func (h *OTelHook) OpStart(ctx context.Context, op *CacheOp) context.Context {
+	ctx, _ = h.tracer.Start(ctx, "cache."+op.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(op.Start),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("cache.op", op.Name),
+			attribute.String("cache.family", otelFamily(op.Family)),
+			attribute.Int("cache.keys", op.Keys),
+		),
+	)
+	return ctx
+}
+
+// OpEnd 实现 CacheHook
+func (h *OTelHook) OpEnd(ctx context.Context, op *CacheOp) {
+	attrs := metric.WithAttributes(
+		attribute.String("cache.op", op.Name),
+		attribute.String("cache.family", otelFamily(op.Family)),
+	)
+	h.requests.Add(ctx, 1, attrs)
+	h.duration.Record(ctx, op.Duration.Seconds(), attrs)
+	if op.Size > 0 {
+		h.size.Record(ctx, int64(op.Size), attrs)
+	}
+	if isReadOp(op.Name) && op.Err == nil {
+		family := attribute.String("cache.family", otelFamily(op.Family))
+		if local := op.LocalHits; local > 0 {
+			h.hits.Add(ctx, int64(local), metric.WithAttributes(family, attribute.String("layer", "local")))
+		}
+		if remote := op.Hits - op.LocalHits; remote > 0 {
+			h.hits.Add(ctx, int64(remote), metric.WithAttributes(family, attribute.String("layer", "redis")))
+		}
+		if misses := op.Misses(); misses > 0 {
+			h.misses.Add(ctx, int64(misses), metric.WithAttributes(family))
+		}
+	}
+	if op.Err != nil {
+		h.errors.Add(ctx, 1, attrs)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if isReadOp(op.Name) {
+		span.SetAttributes(attribute.Int("cache.hits", op.Hits))
+	}
+	span.SetAttributes(attribute.Int("cache.size", op.Size))
+	if op.Err != nil {
+		span.RecordError(op.Err)
+		span.SetStatus(codes.Error, op.Err.Error())
+	}
+	span.End(trace.WithTimestamp(op.Start.Add(op.Duration)))
+}
+
+// isReadOp 是否为统计命中率的读操作
+func isReadOp(name string) bool {
+	return name == "get" || name == "mget"
+}
+
+func otelFamily(family string) string {
+	if family == "" {
+		return otelOtherFamily
+	}
+	return family
+}
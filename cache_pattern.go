@@ -0,0 +1,133 @@
+package nie
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultDelBatchSize = 500
+
+// DelByPatternOptions 定义 DelByPattern 可选参数
+type DelByPatternOptions struct {
+	ScanCount int64               // 每次 SCAN 的 COUNT，默认 100
+	BatchSize int                 // 每批删除的 key 数量，默认 500
+	DryRun    bool                // 仅统计匹配的 key，不执行删除
+	OnBatch   func(keys []string) // 每批 key 删除前回调，可用于 DryRun 输出匹配结果；集群下可能被并发调用
+}
+
+// clusterScanner 支持遍历全部主节点的集群客户端（*redis.ClusterClient）
+type clusterScanner interface {
+	ForEachMaster(ctx context.Context, fn func(ctx context.Context, client *redis.Client) error) error
+}
+
+// DelByPattern 按模式删除 key，返回删除（DryRun 时为匹配）的 key 数量
+//
+// 循环 SCAN 直到游标归零，按 BatchSize 分批删除；优先使用 UNLINK（异步释放内存），不支持时退回 DEL。
+// 集群客户端会遍历每个主节点分别扫描。ctx 取消时立即停止并返回已删除的数量。
+func (c *Cache) DelByPattern(ctx context.Context, pattern string, options ...DelByPatternOptions) (int64, error) {
+	var option DelByPatternOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.ScanCount <= 0 {
+		option.ScanCount = 100
+	}
+	if option.BatchSize <= 0 {
+		option.BatchSize = defaultDelBatchSize
+	}
+	if !option.DryRun && !c.breaker.allow() {
+		return 0, ErrCircuitOpen
+	}
+
+	var total atomic.Int64
+	scan := func(ctx context.Context, client redis.Cmdable) error {
+		useUnlink := true
+		flush := func(keys []string) error {
+			if len(keys) == 0 {
+				return nil
+			}
+			if option.OnBatch != nil {
+				option.OnBatch(keys)
+			}
+			if option.DryRun {
+				total.Add(int64(len(keys)))
+				return nil
+			}
+			n, err := unlinkKeys(ctx, client, keys, &useUnlink)
+			total.Add(n)
+			if err != nil {
+				return err
+			}
+			c.invalidateLocal(ctx, keys...)
+			return nil
+		}
+
+		var cursor uint64
+		var batch []string
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			keys, next, err := client.Scan(ctx, cursor, pattern, option.ScanCount).Result()
+			if err != nil {
+				return err
+			}
+			batch = append(batch, keys...)
+			for len(batch) >= option.BatchSize {
+				if err := flush(batch[:option.BatchSize]); err != nil {
+					return err
+				}
+				batch = batch[option.BatchSize:]
+			}
+			if next == 0 {
+				return flush(batch)
+			}
+			cursor = next
+		}
+	}
+
+	var err error
+	if cluster, ok := c.redis.(clusterScanner); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, c.redis)
+	}
+	c.breaker.record(err)
+	return total.Load(), err
+}
+
+// unlinkKeys 使用 pipeline 逐个删除 key（避免集群下多 key 命令跨槽），返回实际删除的数量
+//
+// useUnlink 为 true 时优先使用 UNLINK，服务端不支持（Redis < 4.0）时置为 false 并改用 DEL 重试
+func unlinkKeys(ctx context.Context, client redis.Cmdable, keys []string, useUnlink *bool) (int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			if *useUnlink {
+				cmds[i] = pipe.Unlink(ctx, key)
+			} else {
+				cmds[i] = pipe.Del(ctx, key)
+			}
+		}
+		return nil
+	})
+	if err != nil && *useUnlink && isUnknownCommand(err) {
+		*useUnlink = false
+		return unlinkKeys(ctx, client, keys, useUnlink)
+	}
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, err
+}
+
+// isUnknownCommand 判断是否为服务端不支持该命令的错误
+func isUnknownCommand(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
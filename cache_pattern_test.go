@@ -0,0 +1,100 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestDelByPattern(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	for i := 0; i < 25; i++ {
+		if err := c.SetRedis(ctx, "scan:"+strings.Repeat("x", i), i, 0); err != nil {
+			t.Fatalf("SetRedis error: %v", err)
+		}
+	}
+	if err := c.SetRedis(ctx, "other", 1, 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+
+	var matched int
+	n, err := c.DelByPattern(ctx, "scan:*", nie.DelByPatternOptions{DryRun: true, ScanCount: 5, BatchSize: 7, OnBatch: func(keys []string) {
+		matched += len(keys)
+	}})
+	if err != nil || n != 25 || matched != 25 {
+		t.Fatalf("DryRun = %d (matched %d), %v", n, matched, err)
+	}
+	if _, err := c.GetRedis(ctx, "scan:"); err != nil {
+		t.Fatalf("DryRun should not delete keys: %v", err)
+	}
+
+	n, err = c.DelByPattern(ctx, "scan:*", nie.DelByPatternOptions{ScanCount: 5, BatchSize: 7})
+	if err != nil || n != 25 {
+		t.Fatalf("DelByPattern = %d, %v", n, err)
+	}
+	if _, err := c.GetRedis(ctx, "other"); err != nil {
+		t.Fatalf("unmatched key should remain: %v", err)
+	}
+}
+
+func TestDelByPattern_Batches(t *testing.T) {
+	c, s := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{}})
+	ctx := context.Background()
+
+	for i := 0; i < 23; i++ {
+		s.Set(fmt.Sprintf("job:%d", i), "v")
+	}
+	// 已读入一级缓存的 key 删除后同步失效
+	if _, err := c.GetRedis(ctx, "job:0"); err != nil {
+		t.Fatalf("GetRedis error: %v", err)
+	}
+
+	var batches []int
+	n, err := c.DelByPattern(ctx, "job:*", nie.DelByPatternOptions{ScanCount: 3, BatchSize: 10, OnBatch: func(keys []string) {
+		batches = append(batches, len(keys))
+	}})
+	if err != nil || n != 23 {
+		t.Fatalf("DelByPattern = %d, %v", n, err)
+	}
+	if len(batches) != 3 || batches[0] != 10 || batches[1] != 10 || batches[2] != 3 {
+		t.Fatalf("batches = %v, want [10 10 3]", batches)
+	}
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Fatalf("remaining keys = %v", keys)
+	}
+	if _, err := c.GetRedis(ctx, "job:0"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("local entry should be invalidated, got %v", err)
+	}
+
+	// 无匹配时不回调
+	n, err = c.DelByPattern(ctx, "job:*", nie.DelByPatternOptions{OnBatch: func(keys []string) {
+		t.Errorf("OnBatch called with %v", keys)
+	}})
+	if err != nil || n != 0 {
+		t.Fatalf("DelByPattern without matches = %d, %v", n, err)
+	}
+}
+
+func TestDelByPattern_Canceled(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 0; i < 10; i++ {
+		s.Set("job:"+strings.Repeat("x", i), "v")
+	}
+	cancel()
+	n, err := c.DelByPattern(ctx, "job:*")
+	if !errors.Is(err, context.Canceled) || n != 0 {
+		t.Fatalf("DelByPattern = %d, %v, want context.Canceled", n, err)
+	}
+	if keys := s.Keys(); len(keys) != 10 {
+		t.Fatalf("canceled DelByPattern should not delete keys, %d remain", len(keys))
+	}
+}
@@ -0,0 +1,128 @@
+package nie
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultTagPrefix    = "tag:"
+	invalidateBatchSize = 500
+)
+
+// tagAddScript 将 key 加入标签集合，并保证集合的过期时间不短于 key 的过期时间
+//
+// KEYS[1] 标签集合；ARGV[1] 缓存 key；ARGV[2] 缓存 key 的过期时间（毫秒，0 表示永不过期）
+var tagAddScript = redis.NewScript(`
+local existed = redis.call("exists", KEYS[1])
+redis.call("sadd", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl <= 0 then
+	redis.call("persist", KEYS[1])
+	return 1
+end
+local cur = redis.call("pttl", KEYS[1])
+if existed == 0 or (cur >= 0 and cur < ttl) then
+	redis.call("pexpire", KEYS[1], ttl)
+end
+return 1
+`)
+
+// SetRedisWithTags 设置缓存并关联标签，之后可通过 InvalidateTags 按标签批量删除
+//
+// 标签以 Redis 集合维护（key 为 CacheOptions.TagPrefix + tag），集合的过期时间不短于其中最长的缓存过期时间。
+// 每条命令只涉及单个 key，可用于集群客户端。
+func (c *Cache) SetRedisWithTags(ctx context.Context, key string, value interface{}, expiration time.Duration, tags ...string) (err error) {
+	ctx, op := c.startOp(ctx, "set", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	data, err := encodeValue(c.codec, value)
+	if err != nil {
+		return err
+	}
+	op.addSize(data)
+	if !c.breaker.allow() {
+		c.dropLocal(key)
+		return ErrCircuitOpen
+	}
+	expiration = c.jitter(expiration)
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, expiration)
+		for _, tag := range tags {
+			tagAddScript.Eval(ctx, pipe, []string{c.tagKey(tag)}, key, expiration.Milliseconds())
+		}
+		return nil
+	})
+	c.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	c.invalidateLocal(ctx, key)
+	return nil
+}
+
+// InvalidateTags 删除标签关联的全部缓存 key，并清理标签集合，返回删除的 key 数量
+//
+// 使用 SSCAN 分批读取成员，删除成功后才通过 SREM 从集合移除：删除失败或进程中途退出时成员仍保留在集合中，
+// 重试即可继续清理；删除过程中新关联且尚未扫描到的 key 会保留在集合中，不会丢失
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	var deleted int64
+	if !c.breaker.allow() {
+		return 0, ErrCircuitOpen
+	}
+	for _, tag := range tags {
+		tagKey := c.tagKey(tag)
+		var cursor uint64
+		for {
+			if err := ctx.Err(); err != nil {
+				return deleted, err
+			}
+			keys, next, err := c.redis.SScan(ctx, tagKey, cursor, "", invalidateBatchSize).Result()
+			c.breaker.record(err)
+			if err != nil {
+				return deleted, err
+			}
+			if len(keys) > 0 {
+				n, err := c.delKeys(ctx, keys)
+				deleted += n
+				if err != nil {
+					return deleted, err
+				}
+				if err := c.redis.SRem(ctx, tagKey, stringsToArgs(keys)...).Err(); err != nil {
+					return deleted, err
+				}
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// delKeys 删除 key 并同步清理一级缓存，返回实际删除的数量
+func (c *Cache) delKeys(ctx context.Context, keys []string) (deleted int64, err error) {
+	ctx, op := c.startBatchOp(ctx, "del", keys)
+	defer func() { c.endOp(ctx, op, err) }()
+	useUnlink := true
+	deleted, err = unlinkKeys(ctx, c.redis, keys, &useUnlink)
+	if err != nil {
+		return deleted, err
+	}
+	c.invalidateLocal(ctx, keys...)
+	return deleted, nil
+}
+
+// tagKey 返回标签集合的 key
+func (c *Cache) tagKey(tag string) string {
+	return c.tagPrefix + tag
+}
+
+func stringsToArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
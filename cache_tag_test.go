@@ -0,0 +1,149 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestInvalidateTags(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedisWithTags(ctx, "ent:42:user:1", "u1", time.Minute, "ent:42"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if err := c.SetRedisWithTags(ctx, "ent:42:dept:1", "d1", time.Hour, "ent:42", "dept"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if err := c.SetRedis(ctx, "ent:43:user:1", "u1", 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+
+	n, err := c.InvalidateTags(ctx, "ent:42")
+	if err != nil || n != 2 {
+		t.Fatalf("InvalidateTags = %d, %v", n, err)
+	}
+	if _, err := c.GetRedis(ctx, "ent:42:dept:1"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("tagged key should be deleted, got %v", err)
+	}
+	if _, err := c.GetRedis(ctx, "ent:43:user:1"); err != nil {
+		t.Fatalf("untagged key should remain: %v", err)
+	}
+}
+
+func TestSetRedisWithTags_TagTTL(t *testing.T) {
+	c, s := newTestCache(t, nie.CacheOptions{TagPrefix: "t:"})
+	ctx := context.Background()
+
+	// 标签集合的过期时间跟随最长的缓存 key，不会被较短的 key 缩短
+	if err := c.SetRedisWithTags(ctx, "a", "a", time.Hour, "dict"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if err := c.SetRedisWithTags(ctx, "b", "b", time.Minute, "dict"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if ttl := s.TTL("t:dict"); ttl != time.Hour {
+		t.Fatalf("tag ttl = %v, want %v", ttl, time.Hour)
+	}
+	if err := c.SetRedisWithTags(ctx, "c", "c", 0, "dict"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if ttl := s.TTL("t:dict"); ttl != 0 {
+		t.Fatalf("tag with a persistent key should not expire, ttl = %v", ttl)
+	}
+
+	// 已过期的 key 也可以安全失效
+	s.FastForward(time.Minute)
+	n, err := c.InvalidateTags(ctx, "dict", "missing")
+	if err != nil || n != 2 {
+		t.Fatalf("InvalidateTags = %d, %v", n, err)
+	}
+	if s.Exists("t:dict") {
+		t.Fatal("tag set should be removed after invalidation")
+	}
+	if _, err := c.GetRedis(ctx, "c"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("tagged key should be deleted, got %v", err)
+	}
+}
+
+func TestInvalidateTags_LocalCache(t *testing.T) {
+	c, _ := newTestCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{}})
+	ctx := context.Background()
+
+	if err := c.SetRedisWithTags(ctx, "dict:1", "v", 0, "dict"); err != nil {
+		t.Fatalf("SetRedisWithTags error: %v", err)
+	}
+	if v, err := c.GetRedis(ctx, "dict:1"); err != nil || v != "v" {
+		t.Fatalf("GetRedis = %q, %v", v, err)
+	}
+	if _, err := c.InvalidateTags(ctx, "dict"); err != nil {
+		t.Fatalf("InvalidateTags error: %v", err)
+	}
+	if _, err := c.GetRedis(ctx, "dict:1"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("local entry should be invalidated, got %v", err)
+	}
+}
+
+// failDeleteHook 开启后使包含 UNLINK/DEL 的 pipeline 失败，模拟删除中途出错
+type failDeleteHook struct {
+	enabled atomic.Bool
+}
+
+func (h *failDeleteHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *failDeleteHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *failDeleteHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if h.enabled.Load() {
+			for _, cmd := range cmds {
+				if name := cmd.Name(); name == "unlink" || name == "del" {
+					return errors.New("delete failed")
+				}
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestInvalidateTags_RetryAfterDeleteFailure(t *testing.T) {
+	client, s := newTestRedis(t)
+	hook := &failDeleteHook{}
+	client.AddHook(hook)
+	c := nie.NewCache(client, nie.CacheOptions{TagPrefix: "t:"})
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		if err := c.SetRedisWithTags(ctx, key, key, 0, "dict"); err != nil {
+			t.Fatalf("SetRedisWithTags error: %v", err)
+		}
+	}
+
+	// 删除失败时成员保留在标签集合中，重试可以继续清理
+	hook.enabled.Store(true)
+	if _, err := c.InvalidateTags(ctx, "dict"); err == nil {
+		t.Fatal("InvalidateTags should fail when delete fails")
+	}
+	if members, _ := s.Members("t:dict"); len(members) != 2 {
+		t.Fatalf("tag members after failed delete = %v, want 2 members", members)
+	}
+
+	hook.enabled.Store(false)
+	n, err := c.InvalidateTags(ctx, "dict")
+	if err != nil || n != 2 {
+		t.Fatalf("InvalidateTags retry = %d, %v", n, err)
+	}
+	if s.Exists("t:dict") || s.Exists("a") || s.Exists("b") {
+		t.Fatal("tagged keys and tag set should be removed after retry")
+	}
+}
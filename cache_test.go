@@ -0,0 +1,107 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+)
+
+type cacheUser struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type cacheStatus int
+
+// newTestRedis 启动进程内 Redis，测试结束时自动关闭客户端
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client, s
+}
+
+// newTestCache 创建连接到进程内 Redis 的 Cache，测试结束时自动调用 Cache.Close
+func newTestCache(t *testing.T, options ...nie.CacheOptions) (*nie.Cache, *miniredis.Miniredis) {
+	t.Helper()
+	client, s := newTestRedis(t)
+	c := nie.NewCache(client, options...)
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	return c, s
+}
+
+func TestCache_SetGetEncodingRules(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "s", "plain", 0); err != nil {
+		t.Fatalf("SetRedis string error: %v", err)
+	}
+	if v, err := c.GetRedis(ctx, "s"); err != nil || v != "plain" {
+		t.Fatalf("GetRedis string = %q, %v", v, err)
+	}
+
+	if err := c.SetRedis(ctx, "i", cacheStatus(3), 0); err != nil {
+		t.Fatalf("SetRedis named int error: %v", err)
+	}
+	var status cacheStatus
+	if _, err := c.GetRedis(ctx, "i", &status); err != nil || status != 3 {
+		t.Fatalf("GetRedis named int = %v, %v", status, err)
+	}
+
+	if err := c.SetRedis(ctx, "b", true, 0); err != nil {
+		t.Fatalf("SetRedis bool error: %v", err)
+	}
+	var b bool
+	if _, err := c.GetRedis(ctx, "b", &b); err != nil || !b {
+		t.Fatalf("GetRedis bool = %v, %v", b, err)
+	}
+
+	if err := c.SetRedis(ctx, "u", cacheUser{ID: 1, Name: "n"}, 0); err != nil {
+		t.Fatalf("SetRedis struct error: %v", err)
+	}
+	if raw, _ := s.Get("u"); raw != `{"id":1,"name":"n"}` {
+		t.Fatalf("struct should be stored as plain JSON, got %q", raw)
+	}
+	var u cacheUser
+	if _, err := c.GetRedis(ctx, "u", &u); err != nil || u.Name != "n" {
+		t.Fatalf("GetRedis struct = %+v, %v", u, err)
+	}
+
+	if _, err := c.GetRedis(ctx, "missing"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("GetRedis missing error = %v, want redis.Nil", err)
+	}
+}
+
+func TestCache_SetNotFound(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "user:1", cacheUser{ID: 1}, time.Hour); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	if err := c.SetNotFound(ctx, "user:1"); err != nil {
+		t.Fatalf("SetNotFound error: %v", err)
+	}
+	if _, err := c.GetRedis(ctx, "user:1"); !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetRedis error = %v, want ErrCacheNotFound", err)
+	}
+	var u cacheUser
+	if _, err := c.GetRedis(ctx, "user:1", &u); !errors.Is(err, nie.ErrCacheNotFound) {
+		t.Fatalf("GetRedis struct error = %v, want ErrCacheNotFound", err)
+	}
+	// 未配置 NegativeTTL 时使用默认过期时间
+	if ttl := s.TTL("user:1"); ttl != nie.DefaultNegativeTTL {
+		t.Fatalf("ttl = %v, want %v", ttl, nie.DefaultNegativeTTL)
+	}
+	s.FastForward(nie.DefaultNegativeTTL)
+	if _, err := c.GetRedis(ctx, "user:1"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("GetRedis after expiry error = %v, want redis.Nil", err)
+	}
+}
@@ -0,0 +1,115 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultEarlyRefreshDelta = time.Second
+
+// slidingExpireScript 剩余过期时间低于阈值时才重置过期时间
+//
+// KEYS[1] 缓存 key；ARGV[1] 新的过期时间（毫秒）；ARGV[2] 阈值（毫秒）。
+// key 不存在或未设置过期时间时不处理，返回 1 表示已续期
+var slidingExpireScript = redis.NewScript(`
+local ttl = redis.call("pttl", KEYS[1])
+if ttl >= 0 and ttl < tonumber(ARGV[2]) then
+	return redis.call("pexpire", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// TTLJitterOptions 定义写入缓存时过期时间的随机抖动，避免批量写入的 key 同时过期（缓存雪崩）
+//
+// 抖动只会延长过期时间，Percent 与 Min/Max 同时配置时两者叠加；expiration 不大于 0（永不过期）时不处理
+type TTLJitterOptions struct {
+	Percent float64       // 按比例延长，如 0.1 表示在 [ttl, ttl*1.1) 内随机
+	Min     time.Duration // 按绝对范围延长 [Min, Max)
+	Max     time.Duration
+}
+
+// TTLRefreshOptions 定义 TTLRefresh 可选参数
+type TTLRefreshOptions struct {
+	Threshold time.Duration // 滑动过期：仅当剩余过期时间低于该阈值时才续期，0 表示总是续期
+}
+
+// jitter 对写入的过期时间增加随机抖动
+func (c *Cache) jitter(expiration time.Duration) time.Duration {
+	if c.ttlJitter == nil || expiration <= 0 {
+		return expiration
+	}
+	if p := c.ttlJitter.Percent; p > 0 {
+		if extra := int64(float64(expiration) * p); extra > 0 {
+			expiration += time.Duration(rand.Int64N(extra))
+		}
+	}
+	if lo, hi := c.ttlJitter.Min, c.ttlJitter.Max; hi > lo && lo >= 0 {
+		expiration += lo + time.Duration(rand.Int64N(int64(hi-lo)))
+	}
+	return expiration
+}
+
+// shouldRefreshEarly XFetch 概率提前刷新：越接近过期，触发刷新的概率越高
+//
+// 条件：delta * beta * -ln(rand) >= 剩余过期时间，delta 为预估的加载耗时
+func shouldRefreshEarly(ttl, delta time.Duration, beta float64) bool {
+	if beta <= 0 || ttl <= 0 {
+		return false
+	}
+	if delta <= 0 {
+		delta = defaultEarlyRefreshDelta
+	}
+	gap := float64(delta) * beta * -math.Log(1-rand.Float64())
+	return gap >= float64(ttl)
+}
+
+// getWithTTL 读取缓存及其剩余过期时间
+//
+// 一级缓存命中时无法得知 Redis 中的剩余时间，返回 ttl = -1
+func (c *Cache) getWithTTL(ctx context.Context, key string) (data []byte, ttl time.Duration, err error) {
+	ctx, op := c.startOp(ctx, "get", key)
+	defer func() { c.endOp(ctx, op, err) }()
+	local := c.localFor(key)
+	if local != nil {
+		if data, ok := local.get(key); ok {
+			c.stats.localHits.Add(1)
+			op.hit(len(data), true)
+			return data, -1, nil
+		}
+		c.stats.localMisses.Add(1)
+	}
+
+	if !c.breaker.allow() {
+		c.stats.redisMisses.Add(1)
+		return nil, 0, redis.Nil
+	}
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	c.breaker.record(err)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, err
+	}
+	data, err = get.Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			c.stats.redisMisses.Add(1)
+		}
+		return nil, 0, err
+	}
+	c.stats.redisHits.Add(1)
+	op.hit(len(data), false)
+	if local != nil {
+		local.set(key, data, pttl.Val())
+	}
+	return data, pttl.Val(), nil
+}
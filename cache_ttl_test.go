@@ -0,0 +1,93 @@
+package nie_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestTTLJitter(t *testing.T) {
+	c, r := nietest.NewCache(t, nie.CacheOptions{TTLJitter: &nie.TTLJitterOptions{Percent: 0.5}})
+	ctx := context.Background()
+
+	varied := false
+	for i := 0; i < 20; i++ {
+		key := "jitter:" + strings.Repeat("x", i)
+		if err := c.SetRedis(ctx, key, i, 100*time.Second); err != nil {
+			t.Fatalf("SetRedis error: %v", err)
+		}
+		ttl := r.Server().TTL(key)
+		if ttl < 100*time.Second || ttl >= 150*time.Second {
+			t.Fatalf("ttl %v out of jitter range", ttl)
+		}
+		if ttl != 100*time.Second {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Fatal("ttl should be jittered")
+	}
+}
+
+func TestTTLRefresh_Sliding(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "session", "s", time.Minute); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	sliding := nie.TTLRefreshOptions{Threshold: 30 * time.Second}
+	r.Advance(20 * time.Second)
+	if err := c.TTLRefresh(ctx, "session", time.Minute, sliding); err != nil {
+		t.Fatalf("TTLRefresh error: %v", err)
+	}
+	if ttl := r.Server().TTL("session"); ttl != 40*time.Second {
+		t.Fatalf("ttl above threshold should not be extended, got %v", ttl)
+	}
+	r.Advance(20 * time.Second)
+	if err := c.TTLRefresh(ctx, "session", time.Minute, sliding); err != nil {
+		t.Fatalf("TTLRefresh error: %v", err)
+	}
+	if ttl := r.Server().TTL("session"); ttl != time.Minute {
+		t.Fatalf("ttl below threshold should be extended, got %v", ttl)
+	}
+}
+
+func TestGetOrLoad_EarlyRefresh(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "hot", "old", time.Minute); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	refreshed := make(chan struct{}, 1)
+	loader := func(ctx context.Context) (string, error) {
+		refreshed <- struct{}{}
+		return "new", nil
+	}
+	// δ 远大于剩余过期时间，必然触发提前刷新
+	option := nie.LoadOptions{EarlyRefreshBeta: 1, EarlyRefreshDelta: 24 * time.Hour}
+	v, err := nie.GetOrLoad(ctx, c, "hot", time.Minute, loader, option)
+	if err != nil || v != "old" {
+		t.Fatalf("GetOrLoad should return current value, got %q, %v", v, err)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("early refresh was not triggered")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := c.GetRedis(ctx, "hot"); v == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed value was not written back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,292 @@
+package nie
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// codecMagic 编码头部的首字节
+//
+// 带头部的数据格式为 [codecMagic, Codec.ID(), payload...]；0xFE 不会出现在合法的 UTF-8/JSON 文本开头，
+// 因此不带头部的历史 JSON 数据仍按 JSON 解码
+const codecMagic byte = 0xFE
+
+// Codec 定义 Cache 对结构体等复杂类型的编解码方式
+//
+// 字符串与基本类型始终按 SetRedis 的规则直接存储，不经过 Codec
+type Codec interface {
+	// ID 写入头部的编码标识，读取时据此选择解码器；0 表示不写头部（仅 JSONCodec 使用，兼容历史数据）
+	ID() byte
+	// Name 编码名称，用于日志与排查
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// frameEncoder 可选接口：由编码器自行输出带头部的完整数据
+//
+// 压缩包装器在数据小于阈值时直接输出内层编码结果，不额外增加压缩头部
+type frameEncoder interface {
+	encodeFrame(v interface{}) ([]byte, error)
+}
+
+var (
+	// JSONCodec 使用 encoding/json 编码，不写头部，与历史数据完全兼容（默认）
+	JSONCodec Codec = jsonCodec{}
+	// ProtoCodec 使用 protobuf 二进制编码，值必须为 proto.Message
+	ProtoCodec Codec = protoCodec{}
+	// ProtoJSONCodec 使用 protojson 编码，值必须为 proto.Message，int64/枚举/oneof 语义无损
+	ProtoJSONCodec Codec = protoJSONCodec{}
+	// MsgpackCodec 使用 msgpack 编码，字段名沿用 json 标签
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{}
+)
+
+func init() {
+	RegisterCodec(ProtoCodec)
+	RegisterCodec(ProtoJSONCodec)
+	RegisterCodec(MsgpackCodec)
+	RegisterCodec(gzipCodec{})
+}
+
+// RegisterCodec 注册自定义编码，读取时按头部中的 ID 查找解码器
+//
+// ID 为 0 或与已注册的其他编码冲突时 panic
+func RegisterCodec(codec Codec) {
+	if codec == nil || codec.ID() == 0 {
+		panic("nie: RegisterCodec codec is nil or has zero ID")
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if old, ok := codecs[codec.ID()]; ok && old.Name() != codec.Name() {
+		panic(fmt.Sprintf("nie: RegisterCodec ID %q already registered by %s", codec.ID(), old.Name()))
+	}
+	codecs[codec.ID()] = codec
+}
+
+// NewGzipCodec 创建压缩包装器：inner 编码结果不小于 threshold 字节时进行 gzip 压缩
+//
+// 小于阈值的数据原样输出 inner 的编码结果；读取时根据头部自动解压
+func NewGzipCodec(inner Codec, threshold int) Codec {
+	if inner == nil {
+		inner = JSONCodec
+	}
+	return gzipCodec{inner: inner, threshold: threshold}
+}
+
+// WithCodec 返回使用指定编码的 Cache 副本，用于单次调用切换编码
+//
+// 副本与原 Cache 共享 Redis 客户端、一级缓存与统计等资源，只需对原 Cache 调用 Close
+func (c *Cache) WithCodec(codec Codec) *Cache {
+	clone := *c
+	clone.codec = codec
+	if clone.codec == nil {
+		clone.codec = JSONCodec
+	}
+	return &clone
+}
+
+// encodeFrame 使用 codec 编码并写入头部
+func encodeFrame(codec Codec, v interface{}) ([]byte, error) {
+	if fe, ok := codec.(frameEncoder); ok {
+		return fe.encodeFrame(v)
+	}
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if codec.ID() == 0 {
+		return payload, nil
+	}
+	data := make([]byte, 0, len(payload)+2)
+	data = append(data, codecMagic, codec.ID())
+	return append(data, payload...), nil
+}
+
+// decodeFrame 根据头部选择解码器；不带头部的数据按 JSON 解码
+func decodeFrame(data []byte, v interface{}) error {
+	if len(data) < 2 || data[0] != codecMagic {
+		return json.Unmarshal(data, v)
+	}
+	codecsMu.RLock()
+	codec, ok := codecs[data[1]]
+	codecsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("nie: unknown codec ID %q", data[1])
+	}
+	return codec.Unmarshal(data[2:], v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte     { return 0 }
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ID() byte     { return 'p' }
+func (protoCodec) Name() string { return "proto" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("nie: proto codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, err := protoTarget(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type protoJSONCodec struct{}
+
+func (protoJSONCodec) ID() byte     { return 'P' }
+func (protoJSONCodec) Name() string { return "protojson" }
+
+func (protoJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("nie: protojson codec: %T is not a proto.Message", v)
+	}
+	return protojson.Marshal(m)
+}
+
+func (protoJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	m, err := protoTarget(v)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// protoTarget 取得解码目标消息，支持 *M 与 **M（如 GetOrLoad[*pb.User] 的 &v），后者为 nil 时自动分配
+func protoTarget(v interface{}) (proto.Message, error) {
+	if m, ok := v.(proto.Message); ok {
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		elem := rv.Elem()
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		if m, ok := elem.Interface().(proto.Message); ok {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("nie: proto codec: %T is not a proto.Message", v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte     { return 'm' }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type gzipCodec struct {
+	inner     Codec
+	threshold int
+}
+
+func (gzipCodec) ID() byte     { return 'z' }
+func (gzipCodec) Name() string { return "gzip" }
+
+// Marshal 压缩 inner 的完整编码结果（含 inner 头部）
+func (g gzipCodec) Marshal(v interface{}) ([]byte, error) {
+	inner, err := encodeFrame(g.innerCodec(), v)
+	if err != nil {
+		return nil, err
+	}
+	return gzipBytes(inner)
+}
+
+// Unmarshal 解压后按 inner 的头部继续解码
+func (gzipCodec) Unmarshal(data []byte, v interface{}) error {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	inner, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return decodeFrame(inner, v)
+}
+
+func (g gzipCodec) encodeFrame(v interface{}) ([]byte, error) {
+	inner, err := encodeFrame(g.innerCodec(), v)
+	if err != nil {
+		return nil, err
+	}
+	if len(inner) < g.threshold {
+		return inner, nil
+	}
+	compressed, err := gzipBytes(inner)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(compressed)+2)
+	data = append(data, codecMagic, g.ID())
+	return append(data, compressed...), nil
+}
+
+func (g gzipCodec) innerCodec() Codec {
+	if g.inner == nil {
+		return JSONCodec
+	}
+	return g.inner
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package nie_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	nie "github.com/sca-rab/nie-go"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// base64Codec 测试用自定义编码
+type base64Codec struct{}
+
+func (base64Codec) ID() byte     { return 'b' }
+func (base64Codec) Name() string { return "base64" }
+
+func (base64Codec) Marshal(v interface{}) ([]byte, error) {
+	data, err := nie.JSONCodec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func (base64Codec) Unmarshal(data []byte, v interface{}) error {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+	return nie.JSONCodec.Unmarshal(raw, v)
+}
+
+func TestCodecs(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	codecs := []nie.Codec{nie.MsgpackCodec, nie.NewGzipCodec(nie.JSONCodec, 16), nie.NewGzipCodec(nie.MsgpackCodec, 1<<20)}
+	for _, codec := range codecs {
+		want := cacheUser{ID: 9, Name: strings.Repeat("x", 64)}
+		if err := c.WithCodec(codec).SetRedis(ctx, "codec", want, 0); err != nil {
+			t.Fatalf("%s SetRedis error: %v", codec.Name(), err)
+		}
+		var got cacheUser
+		if _, err := c.GetRedis(ctx, "codec", &got); err != nil || got != want {
+			t.Fatalf("%s GetRedis = %+v, %v", codec.Name(), got, err)
+		}
+	}
+
+	pb, err := structpb.NewStruct(map[string]interface{}{"name": "pb"})
+	if err != nil {
+		t.Fatalf("NewStruct error: %v", err)
+	}
+	pc := c.WithCodec(nie.ProtoCodec)
+	if err := pc.SetRedis(ctx, "pb", pb, 0); err != nil {
+		t.Fatalf("proto SetRedis error: %v", err)
+	}
+	got, err := nie.GetOrLoad(ctx, c, "pb", 0, func(ctx context.Context) (*structpb.Struct, error) {
+		t.Fatal("loader should not be called")
+		return nil, nil
+	})
+	if err != nil || got.GetFields()["name"].GetStringValue() != "pb" {
+		t.Fatalf("GetOrLoad proto = %v, %v", got, err)
+	}
+}
+
+func TestCodecs_Header(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+	small := cacheUser{ID: 1, Name: "n"}
+	large := cacheUser{ID: 2, Name: strings.Repeat("x", 256)}
+
+	cases := []struct {
+		name   string
+		codec  nie.Codec
+		value  cacheUser
+		header string
+	}{
+		{"json", nie.JSONCodec, small, ""},
+		{"msgpack", nie.MsgpackCodec, small, "\xfem"},
+		{"gzip below threshold", nie.NewGzipCodec(nie.MsgpackCodec, 128), small, "\xfem"},
+		{"gzip above threshold", nie.NewGzipCodec(nie.MsgpackCodec, 128), large, "\xfez"},
+	}
+	for _, tc := range cases {
+		if err := c.WithCodec(tc.codec).SetRedis(ctx, "codec", tc.value, 0); err != nil {
+			t.Fatalf("%s SetRedis error: %v", tc.name, err)
+		}
+		raw, _ := s.Get("codec")
+		if tc.header == "" && strings.HasPrefix(raw, "\xfe") || !strings.HasPrefix(raw, tc.header) {
+			t.Fatalf("%s stored %q, want header %q", tc.name, raw, tc.header)
+		}
+		// 读取时根据头部自动选择解码器，与当前 Cache 的编码无关
+		var got cacheUser
+		if _, err := c.WithCodec(nie.ProtoCodec).GetRedis(ctx, "codec", &got); err != nil || got != tc.value {
+			t.Fatalf("%s GetRedis = %+v, %v", tc.name, got, err)
+		}
+	}
+
+	if err := c.WithCodec(nie.ProtoCodec).SetRedis(ctx, "codec", small, 0); err == nil {
+		t.Fatal("ProtoCodec should reject non-proto values")
+	}
+	s.Set("codec", "\xfe?payload")
+	var got cacheUser
+	if _, err := c.GetRedis(ctx, "codec", &got); err == nil {
+		t.Fatal("unknown codec ID should return error")
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	nie.RegisterCodec(base64Codec{})
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	want := cacheUser{ID: 3, Name: "b"}
+	if err := c.WithCodec(base64Codec{}).SetRedis(ctx, "custom", want, 0); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	if raw, _ := s.Get("custom"); !strings.HasPrefix(raw, "\xfeb") {
+		t.Fatalf("stored %q, want custom header", raw)
+	}
+	var got cacheUser
+	if _, err := c.GetRedis(ctx, "custom", &got); err != nil || got != want {
+		t.Fatalf("GetRedis = %+v, %v", got, err)
+	}
+
+	mustPanic := func(name string, codec nie.Codec) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("RegisterCodec %s should panic", name)
+			}
+		}()
+		nie.RegisterCodec(codec)
+	}
+	mustPanic("zero ID", nie.JSONCodec)
+	mustPanic("conflicting ID", conflictCodec{})
+}
+
+// conflictCodec 与 MsgpackCodec 的 ID 冲突
+type conflictCodec struct{ base64Codec }
+
+func (conflictCodec) ID() byte     { return 'm' }
+func (conflictCodec) Name() string { return "conflict" }
@@ -2,6 +2,7 @@ package nie
 
 import (
 	"context"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -19,9 +20,18 @@ const (
 )
 
 // CtxGlobalInt 从上下文中获取元数据
+//
+// 元数据为空时返回 0，不是整数时返回 FAIL_VALIDATE 错误
 func CtxGlobalInt(ctx context.Context, name string) (int64, error) {
 	if md, ok := metadata.FromServerContext(ctx); ok {
-		value, _ := strconv.ParseInt(md.Get(name), 10, 64)
+		raw := strings.TrimSpace(md.Get(name))
+		if raw == "" {
+			return 0, nil
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, errors.BadRequest("FAIL_VALIDATE", "元数据格式错误").WithMetadata(map[string]string{"field": name}).WithCause(err)
+		}
 		return value, nil
 	}
 	return 0, errors.BadRequest("FAIL_VALIDATE", "认证错误")
@@ -74,39 +84,261 @@ func ctxString(ctx context.Context, name string) string {
 
 }
 
-// ctxArr 从上下文中获取元数据
+// ctxArr 从上下文中获取逗号分隔的元数据
+// 入参：ctx 为上下文；name 为键名
+// 出参：返回去除空白、空项与重复项后的切片，值可以是 string 或 []string，取不到或类型不匹配时返回 nil
 func ctxArr(ctx context.Context, name string) []string {
-	value := ctx.Value(name).(string)
-	arr := strings.Split(value, ",")
-	return arr
+	switch v := ctx.Value(name).(type) {
+	case string:
+		return splitRoles(v)
+	case []string:
+		return splitRoles(strings.Join(v, ","))
+	}
+	// 未设置或类型不匹配，返回 nil，避免 panic
+	return nil
 }
 
 // CtxUid 从上下文中获取用户ID
+//
+// 经过 IdentityMiddleware 的请求从 Identity 中读取，其余 Ctx* 方法相同
 func CtxUid(ctx context.Context) int64 {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.Uid
+	}
 	return ctxInt(ctx, CtxUidKey)
 }
 
 // CtxNickName 从上下文中获取用户昵称
 func CtxNickName(ctx context.Context) string {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.NickName
+	}
 	return ctxString(ctx, CtxNickNameKey)
 }
 
 // CtxEnterpriseId 从上下文中获取企业ID
 func CtxEnterpriseId(ctx context.Context) int64 {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.EnterpriseId
+	}
 	return ctxInt(ctx, CtxEnterpriseIdKey)
 }
 
 // CtxUname 从上下文中获取用户名
 func CtxUname(ctx context.Context) string {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.Uname
+	}
 	return ctxString(ctx, CtxUnameKey)
 }
 
 // CtxRoleKeys 从上下文中获取角色
 func CtxRoleKeys(ctx context.Context) []string {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.Roles
+	}
 	return ctxArr(ctx, CtxRoleKey)
 }
 
 // CtxOfficeId 从上下文中获取单位ID
 func CtxOfficeId(ctx context.Context) int64 {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.OfficeId
+	}
 	return ctxInt(ctx, CtxOfficeIdKey)
 }
+
+// CtxScalar CtxValue 与 CtxSlice 支持的元素类型
+type CtxScalar interface {
+	~string | ~bool |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// CtxValue 从上下文中获取值，ok 为 false 表示未设置或无法转换为 T，用于区分“不存在”与零值
+//
+// 依次查找：IdentityMiddleware 存入的 Identity（name 为 Ctx*Key 时）、context.WithValue(ctx, name, v) 写入的值、
+// 服务端元数据（按 name 原样查找），取第一个能转换为 T 的值。
+// 值可以是 T 本身、其他数字类型或字符串，字符串按 T 的类型解析
+func CtxValue[T CtxScalar](ctx context.Context, name string) (T, bool) {
+	for _, v := range ctxValues(ctx, name) {
+		if s, ok := v.([]string); ok {
+			if len(s) == 0 {
+				continue
+			}
+			v = s[0]
+		}
+		if t, ok := convertCtxScalar[T](v); ok {
+			return t, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// CtxSlice 从上下文中获取多值，查找顺序同 CtxValue，ok 为 false 表示未设置或无法转换为 []T
+//
+// 值可以是 []T、[]string、[]interface{} 或逗号分隔的字符串，元素去除空白、空项与重复项
+func CtxSlice[T CtxScalar](ctx context.Context, name string) ([]T, bool) {
+	for _, v := range ctxValues(ctx, name) {
+		var items []interface{}
+		switch src := v.(type) {
+		case []string:
+			for _, s := range src {
+				for _, item := range strings.Split(s, ",") {
+					items = append(items, item)
+				}
+			}
+		case []T:
+			for _, item := range src {
+				items = append(items, item)
+			}
+		case []interface{}:
+			items = src
+		case string:
+			for _, item := range strings.Split(src, ",") {
+				items = append(items, item)
+			}
+		default:
+			items = []interface{}{v}
+		}
+
+		var values []T
+		seen := make(map[T]struct{}, len(items))
+		converted := true
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				if item = strings.TrimSpace(s); item == "" {
+					continue
+				}
+			}
+			t, ok := convertCtxScalar[T](item)
+			if !ok {
+				converted = false
+				break
+			}
+			if _, dup := seen[t]; !dup {
+				seen[t] = struct{}{}
+				values = append(values, t)
+			}
+		}
+		if converted && len(values) > 0 {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// ctxValues 按 CtxValue 的查找顺序返回上下文中 name 对应的候选值
+func ctxValues(ctx context.Context, name string) []interface{} {
+	var values []interface{}
+	if identity, ok := IdentityFromContext(ctx); ok {
+		// Identity 中的零值视为未设置
+		var v interface{}
+		switch name {
+		case CtxUidKey:
+			v = identity.Uid
+		case CtxNickNameKey:
+			v = identity.NickName
+		case CtxEnterpriseIdKey:
+			v = identity.EnterpriseId
+		case CtxUnameKey:
+			v = identity.Uname
+		case CtxRoleKey:
+			v = identity.Roles
+		case CtxOfficeIdKey:
+			v = identity.OfficeId
+		default:
+			v = identity.Extra[name]
+		}
+		if rv := reflect.ValueOf(v); !rv.IsZero() && !(rv.Kind() == reflect.Slice && rv.Len() == 0) {
+			values = append(values, v)
+		}
+	}
+	if v := ctx.Value(name); v != nil {
+		values = append(values, v)
+	}
+	if md, ok := metadata.FromServerContext(ctx); ok {
+		if v := md.Values(name); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// convertCtxScalar 将上下文中的值转换为 T，数字类型之间转换时不允许溢出或丢失精度
+func convertCtxScalar[T CtxScalar](v interface{}) (T, bool) {
+	var zero T
+	if t, ok := v.(T); ok {
+		return t, true
+	}
+	dst := reflect.ValueOf(&zero).Elem()
+	src := reflect.ValueOf(v)
+	if s, ok := v.(string); ok {
+		if dst.Kind() == reflect.String {
+			dst.SetString(s)
+			return zero, true
+		}
+		s = strings.TrimSpace(s)
+		switch dst.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return zero, false
+			}
+			dst.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, dst.Type().Bits())
+			if err != nil {
+				return zero, false
+			}
+			dst.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(s, 10, dst.Type().Bits())
+			if err != nil {
+				return zero, false
+			}
+			dst.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(s, dst.Type().Bits())
+			if err != nil {
+				return zero, false
+			}
+			dst.SetFloat(f)
+		}
+		return zero, true
+	}
+	if !isNumberKind(src.Kind()) || !isNumberKind(dst.Kind()) {
+		if src.Kind() == dst.Kind() && src.CanConvert(dst.Type()) {
+			dst.Set(src.Convert(dst.Type()))
+			return zero, true
+		}
+		return zero, false
+	}
+	converted := src.Convert(dst.Type())
+	// 转换回原类型后不相等说明溢出或丢失精度
+	if converted.Convert(src.Type()).Interface() != src.Interface() {
+		return zero, false
+	}
+	if isIntKind(src.Kind()) && isUintKind(dst.Kind()) && src.Int() < 0 {
+		return zero, false
+	}
+	if isUintKind(src.Kind()) && isIntKind(dst.Kind()) && converted.Int() < 0 {
+		return zero, false
+	}
+	dst.Set(converted)
+	return zero, true
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uint64
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntKind(k) || isUintKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
@@ -0,0 +1,91 @@
+package nie_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestCtxRoleKeys(t *testing.T) {
+	if roles := nie.CtxRoleKeys(context.Background()); roles != nil {
+		t.Fatalf("missing roles = %q", roles)
+	}
+	ctx := context.WithValue(context.Background(), nie.CtxRoleKey, 1)
+	if roles := nie.CtxRoleKeys(ctx); roles != nil {
+		t.Fatalf("mismatched type roles = %q", roles)
+	}
+	ctx = context.WithValue(context.Background(), nie.CtxRoleKey, " admin,user,, admin ")
+	if roles := nie.CtxRoleKeys(ctx); !reflect.DeepEqual(roles, []string{"admin", "user"}) {
+		t.Fatalf("roles = %q", roles)
+	}
+}
+
+func TestCtxValue(t *testing.T) {
+	ctx := context.WithValue(context.Background(), nie.CtxUidKey, int64(1))
+	ctx = context.WithValue(ctx, "count", "42")
+	ctx = context.WithValue(ctx, "zero", int32(0))
+	ctx = context.WithValue(ctx, "big", int64(1<<40))
+
+	if v, ok := nie.CtxValue[int64](ctx, nie.CtxUidKey); !ok || v != 1 {
+		t.Fatalf("uid = %d, %v", v, ok)
+	}
+	if v, ok := nie.CtxValue[int](ctx, "count"); !ok || v != 42 {
+		t.Fatalf("count = %d, %v", v, ok)
+	}
+	if v, ok := nie.CtxValue[int64](ctx, "zero"); !ok || v != 0 {
+		t.Fatalf("zero = %d, %v", v, ok)
+	}
+	if _, ok := nie.CtxValue[int64](ctx, "absent"); ok {
+		t.Fatal("absent value should not be ok")
+	}
+	if _, ok := nie.CtxValue[int32](ctx, "big"); ok {
+		t.Fatal("overflowing value should not be ok")
+	}
+
+	// Identity 优先，其次 context 值，最后元数据
+	md := metadata.New(map[string][]string{"officeId": {"7"}, "x-md-global-uname": {"u"}, "tags": {"a,b", "b"}})
+	ctx = metadata.NewServerContext(ctx, md)
+	ctx = nie.NewIdentityContext(ctx, &nie.Identity{Uid: 2, Roles: []string{"admin"}})
+	if v, _ := nie.CtxValue[int64](ctx, nie.CtxUidKey); v != 2 {
+		t.Fatalf("identity uid = %d", v)
+	}
+	if v, ok := nie.CtxValue[int64](ctx, nie.CtxOfficeIdKey); !ok || v != 7 {
+		t.Fatalf("metadata officeId = %d, %v", v, ok)
+	}
+	if _, ok := nie.CtxValue[string](ctx, nie.CtxUnameKey); ok {
+		t.Fatal("prefixed metadata should only be read through IdentityMiddleware")
+	}
+	if v, ok := nie.CtxSlice[string](ctx, "tags"); !ok || !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Fatalf("metadata tags = %q, %v", v, ok)
+	}
+	if v, ok := nie.CtxSlice[string](ctx, nie.CtxRoleKey); !ok || !reflect.DeepEqual(v, []string{"admin"}) {
+		t.Fatalf("identity roles = %q, %v", v, ok)
+	}
+
+	ctx = context.WithValue(context.Background(), "ids", "3, 1,3")
+	if v, ok := nie.CtxSlice[int64](ctx, "ids"); !ok || !reflect.DeepEqual(v, []int64{3, 1}) {
+		t.Fatalf("ids = %v, %v", v, ok)
+	}
+	ctx = context.WithValue(context.Background(), "ids", "1,x")
+	if _, ok := nie.CtxSlice[int64](ctx, "ids"); ok {
+		t.Fatal("invalid ids should not be ok")
+	}
+}
+
+func TestCtxGlobalInt(t *testing.T) {
+	md := metadata.New(map[string][]string{"uid": {"abc"}, "enterpriseId": {"2"}})
+	ctx := metadata.NewServerContext(context.Background(), md)
+	if v, err := nie.CtxGlobalInt(ctx, nie.CtxEnterpriseIdKey); err != nil || v != 2 {
+		t.Fatalf("enterpriseId = %d, %v", v, err)
+	}
+	if v, err := nie.CtxGlobalInt(ctx, nie.CtxOfficeIdKey); err != nil || v != 0 {
+		t.Fatalf("missing officeId = %d, %v", v, err)
+	}
+	if _, err := nie.CtxGlobalInt(ctx, nie.CtxUidKey); !kerrors.IsBadRequest(err) {
+		t.Fatalf("invalid uid error = %v", err)
+	}
+}
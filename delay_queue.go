@@ -0,0 +1,479 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrDelayJobRunning 指定 ID 的任务正在执行，不能重新入队
+	ErrDelayJobRunning = errors.New("delay queue: job is running")
+	// ErrDelayJobNotHeld 确认或重试时任务已超过可见性超时被重新投递
+	ErrDelayJobNotHeld = errors.New("delay queue: job not held")
+	// errDelayWorkerStarted 同一个 DelayWorker 重复启动
+	errDelayWorkerStarted = errors.New("delay queue: worker already started")
+)
+
+const (
+	defaultDelayVisibilityTimeout = 30 * time.Second
+	defaultDelayMaxAttempts       = 5
+	defaultDelayPollInterval      = time.Second
+	minDelayBackoff               = time.Second
+	maxDelayBackoff               = 10 * time.Minute
+)
+
+var _ transport.Server = (*DelayWorker)(nil)
+
+// delayEnqueueScript 写入任务并移出死信集合；任务正在执行时返回 0
+//
+// KEYS[1] 待执行集合；KEYS[2] 执行中集合；KEYS[3] 负载；KEYS[4] 尝试次数；KEYS[5] 死信集合；
+// ARGV[1] 任务 ID；ARGV[2] 到期时间（毫秒）；ARGV[3] 负载
+var delayEnqueueScript = redis.NewScript(`
+if redis.call("zscore", KEYS[2], ARGV[1]) then
+	return 0
+end
+redis.call("zrem", KEYS[5], ARGV[1])
+redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+redis.call("hset", KEYS[3], ARGV[1], ARGV[3])
+redis.call("hdel", KEYS[4], ARGV[1])
+return 1
+`)
+
+// delayClaimScript 认领到期任务
+//
+// 先将超过可见性超时的执行中任务放回待执行集合，再取出到期任务移入执行中集合（分数为可见性截止时间），
+// 尝试次数超过上限的任务移入死信集合。
+// KEYS[1] 待执行；KEYS[2] 执行中；KEYS[3] 负载；KEYS[4] 尝试次数；KEYS[5] 死信；
+// ARGV[1] 当前时间（毫秒）；ARGV[2] 可见性超时（毫秒）；ARGV[3] 最多认领数；ARGV[4] 最大尝试次数（0 表示不限）。
+// 返回 {id, 尝试次数, 负载, ...}
+var delayClaimScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local deadline = now + tonumber(ARGV[2])
+local maxAttempts = tonumber(ARGV[4])
+for _, id in ipairs(redis.call("zrangebyscore", KEYS[2], "-inf", now)) do
+	redis.call("zrem", KEYS[2], id)
+	redis.call("zadd", KEYS[1], now, id)
+end
+local res = {}
+for _, id in ipairs(redis.call("zrangebyscore", KEYS[1], "-inf", now, "limit", 0, ARGV[3])) do
+	redis.call("zrem", KEYS[1], id)
+	local attempts = redis.call("hincrby", KEYS[4], id, 1)
+	if maxAttempts > 0 and attempts > maxAttempts then
+		redis.call("zadd", KEYS[5], now, id)
+	else
+		redis.call("zadd", KEYS[2], deadline, id)
+		table.insert(res, id)
+		table.insert(res, attempts)
+		table.insert(res, redis.call("hget", KEYS[3], id) or "")
+	end
+end
+return res
+`)
+
+// delayMoveScript 执行中任务的可见性截止时间与认领时一致时，移入目标集合
+//
+// KEYS[1] 执行中；KEYS[2] 目标集合；ARGV[1] 任务 ID；ARGV[2] 认领时的截止时间；ARGV[3] 目标分数
+var delayMoveScript = redis.NewScript(`
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("zadd", KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+// delayAckScript 执行中任务的可见性截止时间与认领时一致时删除任务
+//
+// KEYS[1] 执行中；KEYS[2] 负载；KEYS[3] 尝试次数；ARGV[1] 任务 ID；ARGV[2] 认领时的截止时间
+var delayAckScript = redis.NewScript(`
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1])
+return 1
+`)
+
+// delayCancelScript 删除尚未执行的任务
+//
+// KEYS[1] 待执行；KEYS[2] 负载；KEYS[3] 尝试次数；ARGV[1] 任务 ID
+var delayCancelScript = redis.NewScript(`
+if redis.call("zrem", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("hdel", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1])
+return 1
+`)
+
+// DelayQueueOptions 定义延迟队列可选参数
+type DelayQueueOptions struct {
+	VisibilityTimeout time.Duration                     // 认领后的可见性超时，超时未确认的任务会被重新投递，默认 30s
+	MaxAttempts       int64                             // 最大尝试次数，超过后移入死信集合，默认 5，小于 0 表示不限
+	Backoff           func(attempt int64) time.Duration // 第 attempt 次失败后的重试延迟，默认从 1s 指数增长，最长 10 分钟
+}
+
+// EnqueueOptions 定义入队可选参数
+type EnqueueOptions struct {
+	ID string // 任务 ID，默认随机生成；相同 ID 的待执行任务会被覆盖（更新负载与到期时间），死信任务会移出死信集合重新执行，可用于 Cancel
+}
+
+// DelayJob 认领到的任务
+type DelayJob struct {
+	ID       string
+	Queue    string
+	Data     []byte // 入队时的负载
+	Attempts int64  // 第几次执行，从 1 开始
+
+	deadline int64 // 认领时的可见性截止时间（毫秒），确认与重试时校验
+}
+
+// Decode 按 GetRedis 的规则将负载解码到 dst
+func (j *DelayJob) Decode(dst interface{}) error {
+	return decodeValue(j.Data, dst)
+}
+
+// DelayQueue 基于 Redis 有序集合的延迟队列
+//
+// 任务按到期时间存放在有序集合中，认领、确认、重试均为 Lua 原子操作；同一队列的 key 使用队列名作为哈希标签，
+// 可用于集群客户端。任务至少执行一次，处理函数应保证幂等
+type DelayQueue struct {
+	c       *Cache
+	name    string
+	options DelayQueueOptions
+
+	ready    string // 待执行，分数为到期时间
+	running  string // 执行中，分数为可见性截止时间
+	data     string // 负载
+	attempts string // 尝试次数
+	dead     string // 死信，分数为移入时间
+}
+
+// NewDelayQueue 创建延迟队列，name 为队列名，不能包含 ':'、'{'、'}' 或空白字符
+func (c *Cache) NewDelayQueue(name string, options ...DelayQueueOptions) (*DelayQueue, error) {
+	var option DelayQueueOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.VisibilityTimeout <= 0 {
+		option.VisibilityTimeout = defaultDelayVisibilityTimeout
+	}
+	if option.MaxAttempts == 0 {
+		option.MaxAttempts = defaultDelayMaxAttempts
+	}
+	if option.MaxAttempts < 0 {
+		option.MaxAttempts = 0
+	}
+	if option.Backoff == nil {
+		option.Backoff = defaultDelayBackoff
+	}
+
+	q := &DelayQueue{c: c, name: name, options: option}
+	hashTag := KeyTemplateOptions{HashTag: "queue"}
+	for _, k := range []struct {
+		family string
+		dst    *string
+	}{
+		{"ready", &q.ready},
+		{"running", &q.running},
+		{"data", &q.data},
+		{"attempts", &q.attempts},
+		{"dead", &q.dead},
+	} {
+		t, err := c.keys.Define("delay."+k.family, "delay:{queue}:"+k.family, hashTag)
+		if err != nil {
+			return nil, err
+		}
+		if *k.dst, err = t.Key(name); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// Enqueue 写入任务，delay 后到期
+func (q *DelayQueue) Enqueue(ctx context.Context, value interface{}, delay time.Duration, options ...EnqueueOptions) (string, error) {
+	return q.EnqueueAt(ctx, value, q.c.now().Add(delay), options...)
+}
+
+// EnqueueAt 写入任务，at 时到期；value 按 SetRedis 的规则编码
+func (q *DelayQueue) EnqueueAt(ctx context.Context, value interface{}, at time.Time, options ...EnqueueOptions) (string, error) {
+	var option EnqueueOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	id := option.ID
+	if id == "" {
+		var err error
+		if id, err = randomHex(16); err != nil {
+			return "", err
+		}
+	}
+	data, err := encodeValue(q.c.codec, value)
+	if err != nil {
+		return "", err
+	}
+	n, err := delayEnqueueScript.Run(ctx, q.c.redis, []string{q.ready, q.running, q.data, q.attempts, q.dead}, id, at.UnixMilli(), data).Int64()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrDelayJobRunning
+	}
+	return id, nil
+}
+
+// EnqueueAtString 写入任务，到期时间为字符串
+//
+// 支持 RFC3339（保持其时区）以及 "2006-01-02 15:04:05"、"2006-01-02"（按 SetDefaultTimeLocation 设置的默认时区解释）
+func (q *DelayQueue) EnqueueAtString(ctx context.Context, value interface{}, at string, options ...EnqueueOptions) (string, error) {
+	t, err := parseDueTime(at)
+	if err != nil {
+		return "", err
+	}
+	return q.EnqueueAt(ctx, value, t, options...)
+}
+
+// Cancel 取消尚未执行的任务，任务不存在或正在执行时返回 false
+func (q *DelayQueue) Cancel(ctx context.Context, id string) (bool, error) {
+	n, err := delayCancelScript.Run(ctx, q.c.redis, []string{q.ready, q.data, q.attempts}, id).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Claim 认领最多 n 个到期任务，认领后需在可见性超时内调用 Ack 或 Retry
+func (q *DelayQueue) Claim(ctx context.Context, n int64) ([]*DelayJob, error) {
+	if n <= 0 {
+		n = 1
+	}
+	now := q.c.now()
+	values, err := delayClaimScript.Run(ctx, q.c.redis, []string{q.ready, q.running, q.data, q.attempts, q.dead},
+		now.UnixMilli(), q.options.VisibilityTimeout.Milliseconds(), n, q.options.MaxAttempts).Slice()
+	if err != nil {
+		return nil, err
+	}
+	deadline := now.UnixMilli() + q.options.VisibilityTimeout.Milliseconds()
+	jobs := make([]*DelayJob, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		id, _ := values[i].(string)
+		attempts, _ := values[i+1].(int64)
+		data, _ := values[i+2].(string)
+		jobs = append(jobs, &DelayJob{ID: id, Queue: q.name, Data: []byte(data), Attempts: attempts, deadline: deadline})
+	}
+	return jobs, nil
+}
+
+// Ack 确认任务执行成功并删除任务
+func (q *DelayQueue) Ack(ctx context.Context, job *DelayJob) error {
+	n, err := delayAckScript.Run(ctx, q.c.redis, []string{q.running, q.data, q.attempts}, job.ID, job.deadline).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDelayJobNotHeld
+	}
+	return nil
+}
+
+// Retry 任务执行失败，按 Backoff 延迟后重新执行；已达到 MaxAttempts 时移入死信集合
+func (q *DelayQueue) Retry(ctx context.Context, job *DelayJob) error {
+	now := q.c.now()
+	target, score := q.ready, now.Add(q.options.Backoff(job.Attempts)).UnixMilli()
+	if q.options.MaxAttempts > 0 && job.Attempts >= q.options.MaxAttempts {
+		target, score = q.dead, now.UnixMilli()
+	}
+	n, err := delayMoveScript.Run(ctx, q.c.redis, []string{q.running, target}, job.ID, job.deadline, score).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDelayJobNotHeld
+	}
+	return nil
+}
+
+// Dead 返回死信集合中的任务 ID，最多 n 个，按移入时间升序
+func (q *DelayQueue) Dead(ctx context.Context, n int64) ([]string, error) {
+	return q.c.redis.ZRange(ctx, q.dead, 0, n-1).Result()
+}
+
+// Len 返回待执行与执行中的任务数
+func (q *DelayQueue) Len(ctx context.Context) (ready, running int64, err error) {
+	ready, err = q.c.redis.ZCard(ctx, q.ready).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	running, err = q.c.redis.ZCard(ctx, q.running).Result()
+	return ready, running, err
+}
+
+// DelayHandler 任务处理函数，返回 nil 时确认任务，返回错误时按 Backoff 重试
+type DelayHandler func(ctx context.Context, job *DelayJob) error
+
+// DelayWorkerOptions 定义延迟队列执行器可选参数
+type DelayWorkerOptions struct {
+	Concurrency  int           // 并发执行的任务数，默认 1
+	PollInterval time.Duration // 没有到期任务时的轮询间隔，默认 1s
+}
+
+// DelayWorker 延迟队列执行器
+//
+// 实现了 Kratos transport.Server，可通过 kratos.Server 注册，随应用启动与停止
+type DelayWorker struct {
+	q       *DelayQueue
+	handler DelayHandler
+	options DelayWorkerOptions
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWorker 创建执行器，调用 Start 后开始执行到期任务
+func (q *DelayQueue) NewWorker(handler DelayHandler, options ...DelayWorkerOptions) *DelayWorker {
+	var option DelayWorkerOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Concurrency <= 0 {
+		option.Concurrency = 1
+	}
+	if option.PollInterval <= 0 {
+		option.PollInterval = defaultDelayPollInterval
+	}
+	return &DelayWorker{q: q, handler: handler, options: option, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start 开始执行到期任务，阻塞直到 Stop 被调用或 ctx 结束
+//
+// 处理函数收到的 ctx 不会随 ctx 取消，Stop 会等待正在执行的任务完成
+func (w *DelayWorker) Start(ctx context.Context) error {
+	w.mu.Lock()
+	if w.started {
+		w.mu.Unlock()
+		return errDelayWorkerStarted
+	}
+	w.started = true
+	w.mu.Unlock()
+	defer close(w.done)
+
+	handlerCtx := context.WithoutCancel(ctx)
+	for {
+		select {
+		case <-w.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		jobs, err := w.q.Claim(ctx, int64(w.options.Concurrency))
+		if err != nil && ctx.Err() == nil {
+			w.q.c.logf("claim jobs of delay queue %s failed: %v", w.q.name, err)
+		}
+		if len(jobs) == 0 {
+			select {
+			case <-w.stop:
+				return nil
+			case <-ctx.Done():
+				return nil
+			case <-time.After(w.options.PollInterval):
+			}
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *DelayJob) {
+				defer wg.Done()
+				w.run(handlerCtx, job)
+			}(job)
+		}
+		wg.Wait()
+	}
+}
+
+// Stop 停止执行并等待正在执行的任务完成，等待受 ctx 控制
+func (w *DelayWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	started := w.started
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	w.mu.Unlock()
+	if !started {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 执行单个任务并确认或重试
+func (w *DelayWorker) run(ctx context.Context, job *DelayJob) {
+	if err := w.invoke(ctx, job); err != nil {
+		w.q.c.logf("run job %s of delay queue %s failed (attempt %d): %v", job.ID, w.q.name, job.Attempts, err)
+		if err := w.q.Retry(ctx, job); err != nil {
+			w.q.c.logf("retry job %s of delay queue %s failed: %v", job.ID, w.q.name, err)
+		}
+		return
+	}
+	if err := w.q.Ack(ctx, job); err != nil {
+		w.q.c.logf("ack job %s of delay queue %s failed: %v", job.ID, w.q.name, err)
+	}
+}
+
+// invoke 调用处理函数，panic 视为执行失败
+func (w *DelayWorker) invoke(ctx context.Context, job *DelayJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.handler(ctx, job)
+}
+
+// defaultDelayBackoff 默认重试延迟：1s、2s、4s……最长 10 分钟
+func defaultDelayBackoff(attempt int64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 20 {
+		return maxDelayBackoff
+	}
+	return min(minDelayBackoff<<(attempt-1), maxDelayBackoff)
+}
+
+// parseDueTime 按 copier 的规则解析到期时间字符串
+func parseDueTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, errors.New("delay queue: empty due time")
+	}
+	var lastErr error
+	for _, layout := range []string{layoutDateTime, layoutDateOnly} {
+		t, err := parseTimeString(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, fmt.Errorf("delay queue: invalid due time %q: %w", value, lastErr)
+}
@@ -0,0 +1,141 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestDelayQueue_ClaimAckRetry(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	q, err := c.NewDelayQueue("order-timeout", nie.DelayQueueOptions{
+		VisibilityTimeout: 10 * time.Second,
+		MaxAttempts:       2,
+		Backoff:           func(int64) time.Duration { return time.Minute },
+	})
+	if err != nil {
+		t.Fatalf("NewDelayQueue error: %v", err)
+	}
+	if _, err := c.NewDelayQueue("a:b"); err == nil {
+		t.Fatal("invalid queue name should fail")
+	}
+
+	if _, err := q.Enqueue(ctx, cacheUser{ID: 1}, 30*time.Minute, nie.EnqueueOptions{ID: "order-1"}); err != nil {
+		t.Fatalf("Enqueue error: %v", err)
+	}
+	q.Enqueue(ctx, "cancel-me", time.Minute, nie.EnqueueOptions{ID: "order-2"})
+	if ok, err := q.Cancel(ctx, "order-2"); err != nil || !ok {
+		t.Fatalf("Cancel = %v, %v", ok, err)
+	}
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 0 {
+		t.Fatalf("jobs should not be due yet: %+v", jobs)
+	}
+
+	r.Advance(30 * time.Minute)
+	jobs, err := q.Claim(ctx, 10)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "order-1" || jobs[0].Attempts != 1 {
+		t.Fatalf("Claim = %+v, %v", jobs, err)
+	}
+	var u cacheUser
+	if err := jobs[0].Decode(&u); err != nil || u.ID != 1 {
+		t.Fatalf("Decode = %+v, %v", u, err)
+	}
+	if _, err := q.Enqueue(ctx, "x", 0, nie.EnqueueOptions{ID: "order-1"}); !errors.Is(err, nie.ErrDelayJobRunning) {
+		t.Fatalf("Enqueue running job error = %v", err)
+	}
+
+	// 可见性超时后重新投递，旧的认领不能再确认
+	r.Advance(10 * time.Second)
+	again, _ := q.Claim(ctx, 10)
+	if len(again) != 1 || again[0].Attempts != 2 {
+		t.Fatalf("redelivery = %+v", again)
+	}
+	if err := q.Ack(ctx, jobs[0]); !errors.Is(err, nie.ErrDelayJobNotHeld) {
+		t.Fatalf("stale Ack error = %v", err)
+	}
+
+	// 达到最大尝试次数后进入死信
+	if err := q.Retry(ctx, again[0]); err != nil {
+		t.Fatalf("Retry error: %v", err)
+	}
+	if dead, _ := q.Dead(ctx, 10); len(dead) != 1 || dead[0] != "order-1" {
+		t.Fatalf("Dead = %v", dead)
+	}
+
+	q.Enqueue(ctx, "ok", 0, nie.EnqueueOptions{ID: "order-3"})
+	jobs, _ = q.Claim(ctx, 10)
+	if err := q.Ack(ctx, jobs[0]); err != nil {
+		t.Fatalf("Ack error: %v", err)
+	}
+	if ready, running, err := q.Len(ctx); err != nil || ready != 0 || running != 0 {
+		t.Fatalf("Len = %d, %d, %v", ready, running, err)
+	}
+
+	// 重新入队的死信任务移出死信集合
+	if _, err := q.Enqueue(ctx, "again", 0, nie.EnqueueOptions{ID: "order-1"}); err != nil {
+		t.Fatalf("re-enqueue dead job error: %v", err)
+	}
+	if dead, _ := q.Dead(ctx, 10); len(dead) != 0 {
+		t.Fatalf("Dead after re-enqueue = %v", dead)
+	}
+	if jobs, _ = q.Claim(ctx, 10); len(jobs) != 1 || jobs[0].ID != "order-1" || jobs[0].Attempts != 1 {
+		t.Fatalf("re-enqueued job = %+v", jobs)
+	}
+}
+
+func TestDelayQueue_EnqueueAtString(t *testing.T) {
+	// 默认时区为 Asia/Shanghai，无时区的字符串按该时区解释
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	nie.SetDefaultTimeLocation(loc)
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	q, _ := c.NewDelayQueue("reminder")
+
+	due := r.Now().In(loc).Add(time.Hour).Truncate(time.Second)
+	if _, err := q.EnqueueAtString(ctx, "wall", due.Format(time.DateTime)); err != nil {
+		t.Fatalf("EnqueueAtString error: %v", err)
+	}
+	if _, err := q.EnqueueAtString(ctx, "rfc", due.UTC().Format(time.RFC3339)); err != nil {
+		t.Fatalf("EnqueueAtString RFC3339 error: %v", err)
+	}
+	if _, err := q.EnqueueAtString(ctx, "bad", "tomorrow 9am"); err == nil {
+		t.Fatal("invalid due time should fail")
+	}
+
+	r.Advance(time.Hour - time.Second)
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 0 {
+		t.Fatalf("jobs claimed early: %+v", jobs)
+	}
+	r.Advance(time.Second)
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 2 {
+		t.Fatalf("due jobs = %+v", jobs)
+	}
+}
+
+func TestDelayWorker(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	ctx := context.Background()
+	q, _ := c.NewDelayQueue("jobs")
+	done := make(chan string, 1)
+	w := q.NewWorker(func(ctx context.Context, job *nie.DelayJob) error {
+		done <- string(job.Data)
+		return nil
+	}, nie.DelayWorkerOptions{Concurrency: 2, PollInterval: 10 * time.Millisecond})
+
+	go w.Start(ctx)
+	q.Enqueue(ctx, "hello", 0)
+	if got := <-done; got != "hello" {
+		t.Fatalf("job data = %q", got)
+	}
+	if err := w.Stop(ctx); err != nil {
+		t.Fatalf("Stop error: %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package nie
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var (
+	// ErrIdempotencyInProgress 相同幂等键的请求正在处理中
+	ErrIdempotencyInProgress = kerrors.Conflict("IDEMPOTENCY_IN_PROGRESS", "请求正在处理中，请勿重复提交")
+	// ErrIdempotencyKeyReused 幂等键已用于参数不同的请求
+	ErrIdempotencyKeyReused = kerrors.New(422, "IDEMPOTENCY_KEY_REUSED", "幂等键已用于其他请求")
+	// ErrIdempotencyKeyInvalid 幂等键格式不合法
+	ErrIdempotencyKeyInvalid = kerrors.BadRequest("IDEMPOTENCY_KEY_INVALID", "幂等键格式错误")
+	// ErrIdempotencyReplayUnavailable 相同幂等键的请求已完成，但结果无法保存，不能重放
+	ErrIdempotencyReplayUnavailable = kerrors.Conflict("IDEMPOTENCY_REPLAY_UNAVAILABLE", "请求已处理，请勿重复提交")
+	// ErrIdempotencyNotHeld 完成或释放时处理中标记已过期或不属于当前请求
+	ErrIdempotencyNotHeld = errors.New("idempotency: marker not held")
+)
+
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyLockTTL = time.Minute
+	defaultIdempotencyHeader  = "Idempotency-Key"
+	maxIdempotencyKeyLength   = 128
+)
+
+// IdempotencyState 幂等记录的状态
+type IdempotencyState int
+
+const (
+	// IdempotencyStarted 首次请求，已写入处理中标记，调用方应执行业务并调用 Complete 或 Release
+	IdempotencyStarted IdempotencyState = iota
+	// IdempotencyInProgress 相同幂等键的请求正在处理中
+	IdempotencyInProgress
+	// IdempotencyDone 相同幂等键的请求已完成，Reply 为保存的结果，为空表示结果未能保存
+	IdempotencyDone
+)
+
+// idempotencyBeginScript 不存在时写入处理中标记，否则返回已有记录
+//
+// KEYS[1] 幂等记录（哈希）；ARGV[1] 标记 token；ARGV[2] 请求指纹；ARGV[3] 标记过期时间（毫秒）。
+// 返回 {状态, 指纹, 结果}，状态 0 表示本次写入了标记
+var idempotencyBeginScript = redis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+	redis.call("hset", KEYS[1], "state", "pending", "token", ARGV[1], "fp", ARGV[2])
+	redis.call("pexpire", KEYS[1], ARGV[3])
+	return {0, ARGV[2], ""}
+end
+local v = redis.call("hmget", KEYS[1], "state", "fp", "reply")
+if v[1] == "done" then
+	return {2, v[2] or "", v[3] or ""}
+end
+return {1, v[2] or "", ""}
+`)
+
+// idempotencyCompleteScript 标记仍属于当前 token 时保存结果
+//
+// KEYS[1] 幂等记录；ARGV[1] 标记 token；ARGV[2] 结果；ARGV[3] 结果保留时间（毫秒）
+var idempotencyCompleteScript = redis.NewScript(`
+if redis.call("hget", KEYS[1], "token") ~= ARGV[1] then
+	return 0
+end
+redis.call("hset", KEYS[1], "state", "done", "reply", ARGV[2])
+redis.call("hdel", KEYS[1], "token")
+redis.call("pexpire", KEYS[1], ARGV[3])
+return 1
+`)
+
+// idempotencyReleaseScript 标记仍属于当前 token 时删除记录，允许客户端重试
+var idempotencyReleaseScript = redis.NewScript(`
+if redis.call("hget", KEYS[1], "token") == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// IdempotencyOptions 定义幂等存储可选参数
+type IdempotencyOptions struct {
+	TTL     time.Duration // 结果保留时间，默认 24 小时
+	LockTTL time.Duration // 处理中标记的过期时间，应大于业务处理的最长耗时，默认 1 分钟
+	Header  string        // 中间件读取幂等键的请求头（gRPC 为 metadata），默认 "Idempotency-Key"
+}
+
+// IdempotencyEntry Begin 的结果
+type IdempotencyEntry struct {
+	State       IdempotencyState
+	Token       string // 处理中标记的 token，State 为 IdempotencyStarted 时有效
+	Fingerprint string // 首次请求的指纹
+	Reply       []byte // 保存的结果，State 为 IdempotencyDone 时有效
+}
+
+// IdempotencyStore 幂等键存储
+//
+// 记录的 key 为 "<Namespace>:idempotency:{enterpriseId}:{uid}:{key}"，按租户与用户隔离。
+// 每个操作只涉及单个 key，可用于集群客户端
+type IdempotencyStore struct {
+	c       *Cache
+	key     *KeyTemplate
+	options IdempotencyOptions
+}
+
+// NewIdempotencyStore 创建幂等键存储
+//
+// key 族 "idempotency" 已按其他模式定义时返回错误
+func (c *Cache) NewIdempotencyStore(options ...IdempotencyOptions) (*IdempotencyStore, error) {
+	var option IdempotencyOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.TTL <= 0 {
+		option.TTL = defaultIdempotencyTTL
+	}
+	if option.LockTTL <= 0 {
+		option.LockTTL = defaultIdempotencyLockTTL
+	}
+	if option.Header == "" {
+		option.Header = defaultIdempotencyHeader
+	}
+	key, err := c.keys.Define("idempotency", "idempotency:{enterpriseId}:{uid}:{key}", KeyTemplateOptions{Description: "幂等键"})
+	if err != nil {
+		return nil, err
+	}
+	return &IdempotencyStore{c: c, key: key, options: option}, nil
+}
+
+// Begin 开始处理幂等键对应的请求
+//
+// 首次请求写入处理中标记并返回 IdempotencyStarted；已有记录时返回其状态。
+// fingerprint 为请求指纹，与首次请求不一致时返回 ErrIdempotencyKeyReused
+func (s *IdempotencyStore) Begin(ctx context.Context, enterpriseId, uid int64, key, fingerprint string) (*IdempotencyEntry, error) {
+	redisKey, err := s.redisKey(enterpriseId, uid, key)
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	values, err := idempotencyBeginScript.Run(ctx, s.c.redis, []string{redisKey}, token, fingerprint, s.options.LockTTL.Milliseconds()).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, errors.New("idempotency: unexpected script result")
+	}
+	state, _ := values[0].(int64)
+	fp, _ := values[1].(string)
+	reply, _ := values[2].(string)
+	entry := &IdempotencyEntry{State: IdempotencyState(state), Fingerprint: fp}
+	switch entry.State {
+	case IdempotencyStarted:
+		entry.Token = token
+		return entry, nil
+	case IdempotencyDone:
+		entry.Reply = []byte(reply)
+	}
+	if fp != fingerprint {
+		return entry, ErrIdempotencyKeyReused
+	}
+	return entry, nil
+}
+
+// Complete 保存请求结果，之后相同幂等键的请求将得到该结果
+func (s *IdempotencyStore) Complete(ctx context.Context, enterpriseId, uid int64, key, token string, reply []byte) error {
+	redisKey, err := s.redisKey(enterpriseId, uid, key)
+	if err != nil {
+		return err
+	}
+	n, err := idempotencyCompleteScript.Run(ctx, s.c.redis, []string{redisKey}, token, reply, s.options.TTL.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdempotencyNotHeld
+	}
+	return nil
+}
+
+// Release 删除处理中标记，业务失败时调用，使客户端可以使用同一幂等键重试
+func (s *IdempotencyStore) Release(ctx context.Context, enterpriseId, uid int64, key, token string) error {
+	redisKey, err := s.redisKey(enterpriseId, uid, key)
+	if err != nil {
+		return err
+	}
+	n, err := idempotencyReleaseScript.Run(ctx, s.c.redis, []string{redisKey}, token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdempotencyNotHeld
+	}
+	return nil
+}
+
+// redisKey 构建幂等记录的 key
+func (s *IdempotencyStore) redisKey(enterpriseId, uid int64, key string) (string, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return "", ErrIdempotencyKeyInvalid
+	}
+	redisKey, err := s.key.Key(enterpriseId, uid, key)
+	if err != nil {
+		return "", ErrIdempotencyKeyInvalid.WithCause(err)
+	}
+	return redisKey, nil
+}
+
+// IdempotencyMiddleware Kratos 服务端幂等中间件
+//
+// 从请求头（gRPC 为 metadata）读取幂等键，未携带时直接执行；幂等键按 CtxEnterpriseId、CtxUid 隔离，
+// 应放在填充用户信息的中间件之后，未登录（uid 为 0）的请求携带幂等键时返回 ErrIdentityMissing。
+// 首次请求执行成功后保存结果，重复请求直接返回保存的结果并在响应头写入
+// Idempotent-Replayed: true；处理中的重复请求返回 ErrIdempotencyInProgress；业务返回错误时删除标记，允许重试。
+// 结果以 protobuf Any 保存，响应不是 proto.Message 或编码失败时只记录已完成，重复请求返回 ErrIdempotencyReplayUnavailable
+func IdempotencyMiddleware(store *IdempotencyStore) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			key := tr.RequestHeader().Get(store.options.Header)
+			if key == "" {
+				return handler(ctx, req)
+			}
+			enterpriseId, uid := CtxEnterpriseId(ctx), CtxUid(ctx)
+			if uid == 0 {
+				return nil, ErrIdentityMissing
+			}
+			fingerprint, err := requestFingerprint(tr.Operation(), req)
+			if err != nil {
+				return nil, err
+			}
+
+			entry, err := store.Begin(ctx, enterpriseId, uid, key, fingerprint)
+			if err != nil {
+				return nil, err
+			}
+			switch entry.State {
+			case IdempotencyInProgress:
+				return nil, ErrIdempotencyInProgress
+			case IdempotencyDone:
+				if len(entry.Reply) == 0 {
+					return nil, ErrIdempotencyReplayUnavailable
+				}
+				reply, err := decodeIdempotentReply(entry.Reply)
+				if err != nil {
+					return nil, err
+				}
+				tr.ReplyHeader().Set("Idempotent-Replayed", "true")
+				return reply, nil
+			}
+
+			reply, err := handler(ctx, req)
+			// 使用独立上下文写入结果，避免请求 ctx 已取消导致标记只能等待过期
+			storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err != nil {
+				if releaseErr := store.Release(storeCtx, enterpriseId, uid, key, entry.Token); releaseErr != nil {
+					store.c.logf("release idempotency key %s failed: %v", key, releaseErr)
+				}
+				return reply, err
+			}
+			// 业务已执行成功，结果无法保存时仍记录为已完成（空结果），避免重试再次执行
+			data, encodeErr := encodeIdempotentReply(reply)
+			if encodeErr != nil {
+				store.c.logf("encode idempotent reply failed for key %s: %v", key, encodeErr)
+			}
+			if completeErr := store.Complete(storeCtx, enterpriseId, uid, key, entry.Token, data); completeErr != nil {
+				store.c.logf("complete idempotency key %s failed: %v", key, completeErr)
+			}
+			return reply, nil
+		}
+	}
+}
+
+// requestFingerprint 计算请求指纹：接口名与请求内容的 SHA-256
+func requestFingerprint(operation string, req interface{}) (string, error) {
+	var data []byte
+	var err error
+	if msg, ok := req.(proto.Message); ok {
+		data, err = proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	} else {
+		data, err = json.Marshal(req)
+	}
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(operation))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// encodeIdempotentReply 将响应编码为 protobuf Any，非 proto.Message 返回错误
+func encodeIdempotentReply(reply interface{}) ([]byte, error) {
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("idempotency: reply %T is not a proto.Message", reply)
+	}
+	packed, err := anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(packed)
+}
+
+// decodeIdempotentReply 解码保存的响应，消息类型需已在 protobuf 全局注册表中注册
+func decodeIdempotentReply(data []byte) (interface{}, error) {
+	var packed anypb.Any
+	if err := proto.Unmarshal(data, &packed); err != nil {
+		return nil, err
+	}
+	return packed.UnmarshalNew()
+}
@@ -0,0 +1,136 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	store, err := c.NewIdempotencyStore()
+	if err != nil {
+		t.Fatalf("NewIdempotencyStore error: %v", err)
+	}
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	entered, block := make(chan struct{}), make(chan struct{})
+	handler := nie.IdempotencyMiddleware(store)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return nil, errors.New("payment failed")
+		}
+		if req.(*structpb.Struct).Fields["slow"] != nil {
+			close(entered)
+			<-block
+		}
+		return structpb.NewStruct(map[string]interface{}{"orderId": float64(calls.Load())})
+	})
+	call := func(uid int64, key string, req *structpb.Struct) (*testTransport, interface{}, error) {
+		tr := newTestTransport("/order.v1.Order/Create")
+		tr.request.Set("Idempotency-Key", key)
+		ctx := context.WithValue(context.Background(), nie.CtxUidKey, uid)
+		reply, err := handler(transport.NewServerContext(ctx, tr), req)
+		return tr, reply, err
+	}
+	req, _ := structpb.NewStruct(map[string]interface{}{"amount": 100.0})
+
+	_, first, err := call(1, "k1", req)
+	if err != nil {
+		t.Fatalf("first call error: %v", err)
+	}
+	tr, replayed, err := call(1, "k1", req)
+	if err != nil || calls.Load() != 1 || tr.reply.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("duplicate call = %v, %v, calls = %d", replayed, err, calls.Load())
+	}
+	if replayed.(*structpb.Struct).Fields["orderId"].GetNumberValue() != first.(*structpb.Struct).Fields["orderId"].GetNumberValue() {
+		t.Fatalf("replayed reply = %v, want %v", replayed, first)
+	}
+
+	// 不同用户使用相同幂等键互不影响
+	if _, _, err := call(2, "k1", req); err != nil || calls.Load() != 2 {
+		t.Fatalf("other user call = %v, calls = %d", err, calls.Load())
+	}
+
+	other, _ := structpb.NewStruct(map[string]interface{}{"amount": 200.0})
+	if _, _, err := call(1, "k1", other); !errors.Is(err, nie.ErrIdempotencyKeyReused) {
+		t.Fatalf("reused key error = %v", err)
+	}
+	if _, _, err := call(1, "a:b", req); !errors.Is(err, nie.ErrIdempotencyKeyInvalid) {
+		t.Fatalf("invalid key error = %v", err)
+	}
+
+	// 处理中的重复请求返回冲突
+	slow, _ := structpb.NewStruct(map[string]interface{}{"slow": true})
+	done := make(chan error)
+	go func() {
+		_, _, err := call(1, "k2", slow)
+		done <- err
+	}()
+	<-entered
+	if _, _, err := call(1, "k2", slow); !errors.Is(err, nie.ErrIdempotencyInProgress) {
+		t.Fatalf("concurrent duplicate error = %v", err)
+	}
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatalf("slow call error: %v", err)
+	}
+
+	// 业务失败时释放标记，允许重试
+	fail.Store(true)
+	if _, _, err := call(1, "k3", req); err == nil {
+		t.Fatal("failing handler should return error")
+	}
+	fail.Store(false)
+	if _, _, err := call(1, "k3", req); err != nil {
+		t.Fatalf("retry after failure error: %v", err)
+	}
+
+	// 未登录的请求不能使用幂等键
+	if _, _, err := call(0, "k4", req); !errors.Is(err, nie.ErrIdentityMissing) {
+		t.Fatalf("anonymous call error = %v", err)
+	}
+}
+
+func TestNewIdempotencyStore_KeyConflict(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	c.Keys().MustDefine("idempotency", "idempotency:{key}")
+	if _, err := c.NewIdempotencyStore(); err == nil {
+		t.Fatal("NewIdempotencyStore should fail when the idempotency family is defined with another pattern")
+	}
+}
+
+func TestIdempotencyMiddleware_NonProtoReply(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	store, err := c.NewIdempotencyStore()
+	if err != nil {
+		t.Fatalf("NewIdempotencyStore error: %v", err)
+	}
+
+	var calls atomic.Int32
+	handler := nie.IdempotencyMiddleware(store)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls.Add(1)
+		return map[string]int{"orderId": 1}, nil
+	})
+	call := func() error {
+		tr := newTestTransport("/order.v1.Order/Create")
+		tr.request.Set("Idempotency-Key", "k1")
+		ctx := context.WithValue(context.Background(), nie.CtxUidKey, int64(1))
+		_, err := handler(transport.NewServerContext(ctx, tr), map[string]int{"amount": 100})
+		return err
+	}
+	if err := call(); err != nil {
+		t.Fatalf("first call error: %v", err)
+	}
+	// 结果无法保存时拒绝重复请求，不再执行业务
+	if err := call(); !errors.Is(err, nie.ErrIdempotencyReplayUnavailable) || calls.Load() != 1 {
+		t.Fatalf("duplicate call error = %v, calls = %d", err, calls.Load())
+	}
+}
@@ -0,0 +1,218 @@
+package nie
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/middleware"
+)
+
+// DefaultIdentityPrefix 身份元数据 key 的默认前缀，与 Kratos 全局元数据传递约定一致
+const DefaultIdentityPrefix = "x-md-global-"
+
+var (
+	// ErrIdentityInvalid 身份元数据格式错误，metadata 中的 field 为出错的元数据 key
+	ErrIdentityInvalid = kerrors.BadRequest("IDENTITY_INVALID", "身份信息格式错误")
+	// ErrIdentityMissing 要求登录的接口缺少用户身份
+	ErrIdentityMissing = kerrors.Unauthorized("IDENTITY_MISSING", "未登录或登录已失效")
+)
+
+// identityKey Identity 在 context 中的 key
+type identityKey struct{}
+
+// Identity 当前请求的用户身份
+type Identity struct {
+	Uid          int64             // 用户ID
+	NickName     string            // 用户昵称
+	EnterpriseId int64             // 企业ID
+	Uname        string            // 用户名
+	Roles        []string          // 角色，元数据中以逗号分隔
+	OfficeId     int64             // 单位ID
+	Extra        map[string]string // IdentityOptions.Extras 指定的其他元数据
+}
+
+// IdentityOptions 定义 IdentityMiddleware 可选参数
+type IdentityOptions struct {
+	Prefix   string   // 元数据 key 前缀，默认 DefaultIdentityPrefix，只读取带该前缀的 key
+	Extras   []string // 额外读取到 Identity.Extra 的元数据名（不含前缀）
+	Required bool     // 为 true 时缺少 uid 返回 ErrIdentityMissing
+}
+
+// NewIdentityContext 返回携带 Identity 的 context
+func NewIdentityContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext 从 context 中获取 Identity
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// IdentityMiddleware 将请求元数据中的身份信息（uid、nickName、enterpriseId、uname、role、officeId）解析为 Identity 存入 context，
+// 之后 CtxUid、CtxEnterpriseId 等从中读取
+//
+// 只读取 metadata.Server 中间件解析的带前缀元数据，不读取原始请求头，避免客户端直接伪造身份；
+// 没有元数据时身份为空（Required 时返回 ErrIdentityMissing）。数字字段格式错误时返回 ErrIdentityInvalid
+func IdentityMiddleware(options ...IdentityOptions) middleware.Middleware {
+	var option IdentityOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Prefix == "" {
+		option.Prefix = DefaultIdentityPrefix
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			identity, err := parseIdentity(ctx, option)
+			if err != nil {
+				return nil, err
+			}
+			if option.Required && identity.Uid == 0 {
+				return nil, ErrIdentityMissing
+			}
+			return handler(NewIdentityContext(ctx, identity), req)
+		}
+	}
+}
+
+// parseIdentity 从服务端元数据解析 Identity，没有元数据时返回空身份
+func parseIdentity(ctx context.Context, option IdentityOptions) (*Identity, error) {
+	md, ok := metadata.FromServerContext(ctx)
+	if !ok {
+		return &Identity{}, nil
+	}
+	lookup := func(name string) (string, string) {
+		key := option.Prefix + name
+		return key, md.Get(key)
+	}
+	parseInt := func(name string) (int64, error) {
+		key, v := lookup(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, ErrIdentityInvalid.WithMetadata(map[string]string{"field": key})
+		}
+		return n, nil
+	}
+
+	identity := &Identity{}
+	var err error
+	if identity.Uid, err = parseInt(CtxUidKey); err != nil {
+		return nil, err
+	}
+	if identity.EnterpriseId, err = parseInt(CtxEnterpriseIdKey); err != nil {
+		return nil, err
+	}
+	if identity.OfficeId, err = parseInt(CtxOfficeIdKey); err != nil {
+		return nil, err
+	}
+	_, identity.NickName = lookup(CtxNickNameKey)
+	_, identity.Uname = lookup(CtxUnameKey)
+	_, roles := lookup(CtxRoleKey)
+	identity.Roles = splitRoles(roles)
+	for _, name := range option.Extras {
+		if _, v := lookup(name); v != "" {
+			if identity.Extra == nil {
+				identity.Extra = make(map[string]string, len(option.Extras))
+			}
+			identity.Extra[name] = v
+		}
+	}
+	return identity, nil
+}
+
+// splitRoles 按逗号拆分角色，去除空白、空项与重复项
+func splitRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" && !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// identityFields Identity 中可传递的字段名，与 Ctx*Key 一致
+var identityFields = []string{CtxUidKey, CtxNickNameKey, CtxEnterpriseIdKey, CtxUnameKey, CtxRoleKey, CtxOfficeIdKey}
+
+// IdentityClientOptions 定义 IdentityClientMiddleware 可选参数
+type IdentityClientOptions struct {
+	Prefix string   // 写入元数据的 key 前缀，默认 DefaultIdentityPrefix，需与下游 IdentityOptions.Prefix 一致
+	Fields []string // 允许传递的字段（Ctx*Key 或 Identity.Extra 中的名称），默认传递 Ctx*Key 对应的全部字段，不含 Extra
+}
+
+// IdentityClientMiddleware 调用下游服务时将当前请求的身份写入出站元数据
+//
+// 身份取自 IdentityMiddleware 存入的 Identity，没有时取自 CtxUid 等读取的 context 值；零值字段不传递。
+// 调用外部服务时应通过 Fields 只放行必要字段，避免泄露内部信息
+func IdentityClientMiddleware(options ...IdentityClientOptions) middleware.Middleware {
+	var option IdentityClientOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Prefix == "" {
+		option.Prefix = DefaultIdentityPrefix
+	}
+	if option.Fields == nil {
+		option.Fields = identityFields
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			values := identityValues(ctx)
+			var kv []string
+			for _, name := range option.Fields {
+				if v := values(name); v != "" {
+					kv = append(kv, option.Prefix+name, v)
+				}
+			}
+			if len(kv) > 0 {
+				ctx = metadata.AppendToClientContext(ctx, kv...)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// identityValues 返回按字段名读取当前身份的函数，数字零值与空字符串返回 ""
+func identityValues(ctx context.Context) func(name string) string {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		identity = &Identity{
+			Uid:          CtxUid(ctx),
+			NickName:     CtxNickName(ctx),
+			EnterpriseId: CtxEnterpriseId(ctx),
+			Uname:        CtxUname(ctx),
+			Roles:        ctxArr(ctx, CtxRoleKey),
+			OfficeId:     CtxOfficeId(ctx),
+		}
+	}
+	formatInt := func(v int64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v, 10)
+	}
+	return func(name string) string {
+		switch name {
+		case CtxUidKey:
+			return formatInt(identity.Uid)
+		case CtxNickNameKey:
+			return identity.NickName
+		case CtxEnterpriseIdKey:
+			return formatInt(identity.EnterpriseId)
+		case CtxUnameKey:
+			return identity.Uname
+		case CtxRoleKey:
+			return strings.Join(identity.Roles, ",")
+		case CtxOfficeIdKey:
+			return formatInt(identity.OfficeId)
+		}
+		return identity.Extra[name]
+	}
+}
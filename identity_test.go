@@ -0,0 +1,111 @@
+package nie_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/transport"
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestIdentityMiddleware(t *testing.T) {
+	var got context.Context
+	handler := nie.IdentityMiddleware(nie.IdentityOptions{Extras: []string{"tenant"}})(func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = ctx
+		return nil, nil
+	})
+
+	md := metadata.New(map[string][]string{
+		"x-md-global-uid":          {"1"},
+		"x-md-global-enterpriseId": {"2"},
+		"x-md-global-nickName":     {"张三"},
+		"x-md-global-role":         {"admin, user,,"},
+		"x-md-global-tenant":       {"t1"},
+	})
+	if _, err := handler(metadata.NewServerContext(context.Background(), md), nil); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if nie.CtxUid(got) != 1 || nie.CtxEnterpriseId(got) != 2 || nie.CtxNickName(got) != "张三" || nie.CtxOfficeId(got) != 0 {
+		t.Fatalf("identity = %d %d %q", nie.CtxUid(got), nie.CtxEnterpriseId(got), nie.CtxNickName(got))
+	}
+	if roles := nie.CtxRoleKeys(got); !reflect.DeepEqual(roles, []string{"admin", "user"}) {
+		t.Fatalf("roles = %q", roles)
+	}
+	if identity, ok := nie.IdentityFromContext(got); !ok || identity.Extra["tenant"] != "t1" {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	// 不读取不带前缀的元数据与原始请求头
+	md = metadata.New(map[string][]string{"uid": {"3"}})
+	if _, err := handler(metadata.NewServerContext(context.Background(), md), nil); err != nil || nie.CtxUid(got) != 0 {
+		t.Fatalf("unprefixed uid = %d, %v", nie.CtxUid(got), err)
+	}
+	tr := newTestTransport("/user.v1.User/Get")
+	tr.request.Set("X-Md-Global-Uid", "3")
+	if _, err := handler(transport.NewServerContext(context.Background(), tr), nil); err != nil || nie.CtxUid(got) != 0 {
+		t.Fatalf("header uid = %d, %v", nie.CtxUid(got), err)
+	}
+
+	md = metadata.New(map[string][]string{"x-md-global-uid": {"abc"}})
+	_, err := handler(metadata.NewServerContext(context.Background(), md), nil)
+	if e := kerrors.FromError(err); e.Reason != "IDENTITY_INVALID" || e.Metadata["field"] != "x-md-global-uid" {
+		t.Fatalf("invalid uid error = %v", err)
+	}
+
+	required := nie.IdentityMiddleware(nie.IdentityOptions{Required: true})(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := required(context.Background(), nil); !kerrors.IsUnauthorized(err) {
+		t.Fatalf("missing uid error = %v", err)
+	}
+	if _, err := required(transport.NewServerContext(context.Background(), tr), nil); !kerrors.IsUnauthorized(err) {
+		t.Fatalf("header-only uid error = %v", err)
+	}
+}
+
+func TestIdentityClientMiddleware(t *testing.T) {
+	var md metadata.Metadata
+	call := func(ctx context.Context, req interface{}) (interface{}, error) {
+		md, _ = metadata.FromClientContext(ctx)
+		return nil, nil
+	}
+
+	identity := &nie.Identity{Uid: 1, EnterpriseId: 2, Roles: []string{"admin", "user"}, Extra: map[string]string{"tenant": "t1"}}
+	ctx := nie.NewIdentityContext(context.Background(), identity)
+	nie.IdentityClientMiddleware()(call)(ctx, nil)
+	if md.Get("x-md-global-uid") != "1" || md.Get("x-md-global-enterpriseId") != "2" || md.Get("x-md-global-role") != "admin,user" {
+		t.Fatalf("metadata = %v", md)
+	}
+	if md.Get("x-md-global-officeId") != "" || md.Get("x-md-global-tenant") != "" {
+		t.Fatalf("zero value and extra should not be sent: %v", md)
+	}
+
+	// 只放行允许的字段
+	nie.IdentityClientMiddleware(nie.IdentityClientOptions{Prefix: "x-md-global-", Fields: []string{nie.CtxUidKey, "tenant"}})(call)(ctx, nil)
+	if md.Get("x-md-global-uid") != "1" || md.Get("x-md-global-tenant") != "t1" || md.Get("x-md-global-enterpriseId") != "" {
+		t.Fatalf("allowlist metadata = %v", md)
+	}
+
+	// 没有 Identity 时读取 context 值，下游 IdentityMiddleware 可还原
+	ctx = context.WithValue(context.Background(), nie.CtxUidKey, int64(5))
+	nie.IdentityClientMiddleware()(call)(ctx, nil)
+	var got int64
+	nie.IdentityMiddleware()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = nie.CtxUid(ctx)
+		return nil, nil
+	})(metadata.NewServerContext(context.Background(), md), nil)
+	if got != 5 {
+		t.Fatalf("downstream uid = %d", got)
+	}
+	// CtxGlobalInt 按原样读取元数据，不补全前缀
+	serverCtx := metadata.NewServerContext(context.Background(), md)
+	if uid, err := nie.CtxGlobalInt(serverCtx, nie.DefaultIdentityPrefix+nie.CtxUidKey); err != nil || uid != 5 {
+		t.Fatalf("CtxGlobalInt = %d, %v", uid, err)
+	}
+	if uid, err := nie.CtxGlobalInt(serverCtx, nie.CtxUidKey); err != nil || uid != 0 {
+		t.Fatalf("CtxGlobalInt unprefixed = %d, %v", uid, err)
+	}
+}
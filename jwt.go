@@ -0,0 +1,310 @@
+package nie
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultJWTHeader       = "Authorization"
+	defaultJWTSessionClaim = "sid"
+	jwtBearerPrefix        = "Bearer "
+)
+
+var (
+	// ErrJWTMissing 请求未携带访问令牌
+	ErrJWTMissing = kerrors.Unauthorized("JWT_MISSING", "缺少访问令牌")
+	// ErrJWTInvalid 访问令牌格式、签名、签发方或受众错误
+	ErrJWTInvalid = kerrors.Unauthorized("JWT_INVALID", "访问令牌无效")
+	// ErrJWTExpired 访问令牌已过期或尚未生效
+	ErrJWTExpired = kerrors.Unauthorized("JWT_EXPIRED", "访问令牌已过期")
+	// ErrJWTRevoked 访问令牌所属的会话已吊销
+	ErrJWTRevoked = kerrors.Unauthorized("JWT_REVOKED", "访问令牌已失效")
+	// ErrJWTClaimsInvalid 身份声明格式错误，metadata 中的 claim 为出错的声明名
+	ErrJWTClaimsInvalid = kerrors.Unauthorized("JWT_CLAIMS_INVALID", "访问令牌声明错误")
+)
+
+// defaultJWTAlgorithms 默认允许的签名算法
+var defaultJWTAlgorithms = []string{"HS256", "RS256", "EdDSA"}
+
+// JWTOptions 定义 JWTMiddleware 参数
+type JWTOptions struct {
+	Key          interface{}            // token 未指定 kid 时使用的密钥：HS256 为 []byte，RS256 为 *rsa.PublicKey，EdDSA 为 ed25519.PublicKey
+	Keys         map[string]interface{} // 按 kid 指定的密钥，类型同 Key
+	JWKSFile     string                 // 本地 JWKS 文件，创建中间件时加载，其中的密钥按 kid 合并到 Keys
+	Algorithms   []string               // 允许的签名算法，默认 HS256、RS256、EdDSA
+	Issuer       string                 // 非空时校验 iss
+	Audience     string                 // 非空时校验 aud
+	Leeway       time.Duration          // 校验 exp/nbf 时允许的时钟偏差
+	AllowNoExp   bool                   // 为 true 时接受没有 exp 声明的令牌，默认拒绝（永不过期的令牌无法通过过期失效）
+	Claims       map[string]string      // Ctx*Key 到声明名的映射，未配置的字段使用与 Ctx*Key 同名的声明；其他名称写入 Identity.Extra
+	Header       string                 // 读取令牌的请求头，默认 "Authorization"，值可带 "Bearer " 前缀
+	TokenStore   *TokenStore            // 非 nil 时校验令牌所属会话仍有效且属于令牌中的 uid，会话 ID 取自 SessionClaim
+	SessionClaim string                 // 会话 ID 声明名，默认 "sid"
+	Now          func() time.Time       // 当前时间，默认 time.Now
+}
+
+// JWTMiddleware 校验请求携带的 JWT，并将身份声明解析为 Identity 存入 context，之后 CtxUid 等从中读取
+//
+// 失败时返回 ErrJWTMissing、ErrJWTInvalid 等 Unauthorized 错误，Reason 保持稳定，可供客户端区分是否需要刷新令牌
+func JWTMiddleware(options JWTOptions) (middleware.Middleware, error) {
+	keys := make(map[string]interface{}, len(options.Keys))
+	for kid, key := range options.Keys {
+		keys[kid] = key
+	}
+	if options.JWKSFile != "" {
+		fileKeys, err := loadJWKSFile(options.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		for kid, key := range fileKeys {
+			keys[kid] = key
+		}
+	}
+	if options.Key == nil && len(keys) == 0 {
+		return nil, errors.New("jwt: no verification key configured")
+	}
+	if len(options.Algorithms) == 0 {
+		options.Algorithms = defaultJWTAlgorithms
+	}
+	if options.Header == "" {
+		options.Header = defaultJWTHeader
+	}
+	if options.SessionClaim == "" {
+		options.SessionClaim = defaultJWTSessionClaim
+	}
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods(options.Algorithms), jwt.WithLeeway(options.Leeway)}
+	if !options.AllowNoExp {
+		parserOptions = append(parserOptions, jwt.WithExpirationRequired())
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+	if options.Now != nil {
+		parserOptions = append(parserOptions, jwt.WithTimeFunc(options.Now))
+	}
+	parser := jwt.NewParser(parserOptions...)
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if options.Key != nil {
+				return options.Key, nil
+			}
+			if len(keys) == 1 {
+				for _, key := range keys {
+					return key, nil
+				}
+			}
+			return nil, errors.New("jwt: token has no kid")
+		}
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("jwt: unknown kid %q", kid)
+	}
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, ErrJWTMissing
+			}
+			raw := strings.TrimSpace(tr.RequestHeader().Get(options.Header))
+			if len(raw) >= len(jwtBearerPrefix) && strings.EqualFold(raw[:len(jwtBearerPrefix)], jwtBearerPrefix) {
+				raw = strings.TrimSpace(raw[len(jwtBearerPrefix):])
+			}
+			if raw == "" {
+				return nil, ErrJWTMissing
+			}
+
+			claims := jwt.MapClaims{}
+			if _, err := parser.ParseWithClaims(raw, claims, keyFunc); err != nil {
+				if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
+					return nil, ErrJWTExpired
+				}
+				return nil, ErrJWTInvalid
+			}
+			identity, err := identityFromClaims(claims, options.Claims)
+			if err != nil {
+				return nil, err
+			}
+			if options.TokenStore != nil {
+				sid, _ := claims[options.SessionClaim].(string)
+				if sid == "" {
+					return nil, ErrJWTRevoked
+				}
+				session, err := options.TokenStore.Session(ctx, sid)
+				if err != nil {
+					if errors.Is(err, ErrTokenInvalid) {
+						return nil, ErrJWTRevoked
+					}
+					return nil, kerrors.ServiceUnavailable("JWT_REVOCATION_UNAVAILABLE", "令牌状态校验失败").WithCause(err)
+				}
+				// 会话必须属于令牌中的用户，防止借用他人的有效会话 ID
+				if session.Uid != identity.Uid {
+					return nil, ErrJWTRevoked
+				}
+			}
+			return handler(NewIdentityContext(ctx, identity), req)
+		}
+	}, nil
+}
+
+// identityFromClaims 按映射将声明解析为 Identity，数字声明可以是 JSON 数字或数字字符串，角色可以是逗号分隔的字符串或字符串数组
+func identityFromClaims(claims jwt.MapClaims, mapping map[string]string) (*Identity, error) {
+	claimName := func(key string) string {
+		if name, ok := mapping[key]; ok && name != "" {
+			return name
+		}
+		return key
+	}
+	parseInt := func(key string) (int64, error) {
+		name := claimName(key)
+		switch v := claims[name].(type) {
+		case nil:
+			return 0, nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if v == "" {
+				return 0, nil
+			}
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return 0, ErrJWTClaimsInvalid.WithMetadata(map[string]string{"claim": name})
+	}
+	str := func(key string) string {
+		s, _ := claims[claimName(key)].(string)
+		return s
+	}
+
+	identity := &Identity{NickName: str(CtxNickNameKey), Uname: str(CtxUnameKey)}
+	var err error
+	if identity.Uid, err = parseInt(CtxUidKey); err != nil {
+		return nil, err
+	}
+	if identity.EnterpriseId, err = parseInt(CtxEnterpriseIdKey); err != nil {
+		return nil, err
+	}
+	if identity.OfficeId, err = parseInt(CtxOfficeIdKey); err != nil {
+		return nil, err
+	}
+	switch v := claims[claimName(CtxRoleKey)].(type) {
+	case string:
+		identity.Roles = splitRoles(v)
+	case []interface{}:
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				identity.Roles = append(identity.Roles, splitRoles(s)...)
+			}
+		}
+	}
+	for key, name := range mapping {
+		if contains(identityFields, key) {
+			continue
+		}
+		if v, ok := claims[name]; ok {
+			if identity.Extra == nil {
+				identity.Extra = make(map[string]string)
+			}
+			if s, ok := v.(string); ok {
+				identity.Extra[key] = s
+			} else {
+				identity.Extra[key] = fmt.Sprint(v)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// jwk JWKS 中的单个密钥，只支持验证所需的公钥字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+// loadJWKSFile 读取本地 JWKS 文件，支持 RSA、OKP(Ed25519) 与 oct 密钥
+func loadJWKSFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwt: parse jwks %s: %w", path, err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwt: jwks key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey 将 JWK 转换为 golang-jwt 使用的验证密钥
+func (k jwk) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Sign() <= 0 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return decode(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
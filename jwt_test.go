@@ -0,0 +1,173 @@
+package nie_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/golang-jwt/jwt/v5"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+// callJWT 携带 Authorization 请求头调用经过中间件的处理函数，返回处理函数收到的 Identity
+func callJWT(m middleware.Middleware, token string) (*nie.Identity, error) {
+	tr := newTestTransport("/user.v1.User/Get")
+	if token != "" {
+		tr.request.Set("Authorization", "Bearer "+token)
+	}
+	var identity *nie.Identity
+	_, err := m(func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, _ = nie.IdentityFromContext(ctx)
+		return nil, nil
+	})(transport.NewServerContext(context.Background(), tr), nil)
+	return identity, err
+}
+
+func signJWT(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign error: %v", err)
+	}
+	return s
+}
+
+func jwtReason(err error) string {
+	return kerrors.FromError(err).Reason
+}
+
+func TestJWTMiddleware_HS256(t *testing.T) {
+	secret := []byte("secret")
+	m, err := nie.JWTMiddleware(nie.JWTOptions{
+		Key:    secret,
+		Issuer: "nie",
+		Claims: map[string]string{nie.CtxUidKey: "sub", "tenant": "tid"},
+	})
+	if err != nil {
+		t.Fatalf("JWTMiddleware error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	token := signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{
+		"iss": "nie", "exp": exp, "sub": "1", "enterpriseId": 2, "role": []string{"admin", " user"}, "tid": "t1",
+	})
+	identity, err := callJWT(m, token)
+	if err != nil {
+		t.Fatalf("valid token error: %v", err)
+	}
+	if identity.Uid != 1 || identity.EnterpriseId != 2 || !reflect.DeepEqual(identity.Roles, []string{"admin", "user"}) || identity.Extra["tenant"] != "t1" {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	cases := []struct {
+		name, token, reason string
+	}{
+		{"missing", "", "JWT_MISSING"},
+		{"bad signature", signJWT(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"iss": "nie", "exp": exp}), "JWT_INVALID"},
+		{"wrong issuer", signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "x", "exp": exp}), "JWT_INVALID"},
+		{"expired", signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "nie", "exp": time.Now().Add(-time.Minute).Unix()}), "JWT_EXPIRED"},
+		{"bad uid", signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "nie", "exp": exp, "sub": "abc"}), "JWT_CLAIMS_INVALID"},
+		{"alg none", signJWT(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", jwt.MapClaims{"iss": "nie", "exp": exp}), "JWT_INVALID"},
+		{"no exp", signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"iss": "nie", "sub": "1"}), "JWT_INVALID"},
+	}
+	for _, tc := range cases {
+		_, err := callJWT(m, tc.token)
+		if !kerrors.IsUnauthorized(err) || jwtReason(err) != tc.reason {
+			t.Fatalf("%s: error = %v", tc.name, err)
+		}
+	}
+
+	// 显式允许没有 exp 的令牌
+	m, _ = nie.JWTMiddleware(nie.JWTOptions{Key: secret, AllowNoExp: true})
+	if identity, err := callJWT(m, signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"uid": 3})); err != nil || identity.Uid != 3 {
+		t.Fatalf("AllowNoExp = %+v, %v", identity, err)
+	}
+}
+
+func TestJWTMiddleware_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": b64(edPub)},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := nie.JWTMiddleware(nie.JWTOptions{JWKSFile: path, Audience: "api"})
+	if err != nil {
+		t.Fatalf("JWTMiddleware error: %v", err)
+	}
+	claims := jwt.MapClaims{"aud": "api", "uid": 7, "exp": time.Now().Add(time.Hour).Unix()}
+
+	if identity, err := callJWT(m, signJWT(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims)); err != nil || identity.Uid != 7 {
+		t.Fatalf("RS256 = %+v, %v", identity, err)
+	}
+	if identity, err := callJWT(m, signJWT(t, jwt.SigningMethodEdDSA, edKey, "ed-1", claims)); err != nil || identity.Uid != 7 {
+		t.Fatalf("EdDSA = %+v, %v", identity, err)
+	}
+	// kid 与算法不匹配、未知 kid 均视为无效
+	if _, err := callJWT(m, signJWT(t, jwt.SigningMethodEdDSA, edKey, "rsa-1", claims)); jwtReason(err) != "JWT_INVALID" {
+		t.Fatalf("mismatched kid error = %v", err)
+	}
+	if _, err := callJWT(m, signJWT(t, jwt.SigningMethodRS256, rsaKey, "unknown", claims)); jwtReason(err) != "JWT_INVALID" {
+		t.Fatalf("unknown kid error = %v", err)
+	}
+	if _, err := nie.JWTMiddleware(nie.JWTOptions{}); err == nil {
+		t.Fatal("missing key should fail")
+	}
+}
+
+func TestJWTMiddleware_Revocation(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	ctx := context.Background()
+	store, err := c.NewTokenStore()
+	if err != nil {
+		t.Fatalf("NewTokenStore error: %v", err)
+	}
+	pair, err := store.Issue(ctx, nie.TokenClaims{Uid: 1, EnterpriseId: 2})
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	secret := []byte("secret")
+	m, _ := nie.JWTMiddleware(nie.JWTOptions{Key: secret, TokenStore: store})
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"uid": 1, "sid": pair.Session.ID, "exp": exp})
+
+	if _, err := callJWT(m, token); err != nil {
+		t.Fatalf("active session error: %v", err)
+	}
+	// 会话属于其他用户时拒绝
+	other := signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"uid": 3, "sid": pair.Session.ID, "exp": exp})
+	if _, err := callJWT(m, other); jwtReason(err) != "JWT_REVOKED" {
+		t.Fatalf("session of another user error = %v", err)
+	}
+	if err := store.Revoke(ctx, pair.AccessToken); err != nil {
+		t.Fatalf("Revoke error: %v", err)
+	}
+	if _, err := callJWT(m, token); jwtReason(err) != "JWT_REVOKED" {
+		t.Fatalf("revoked session error = %v", err)
+	}
+	if _, err := callJWT(m, signJWT(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"uid": 1, "exp": exp})); jwtReason(err) != "JWT_REVOKED" {
+		t.Fatalf("token without sid error = %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package nie
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrKeyArgs 构建 key 时参数个数或取值不合法
+	ErrKeyArgs = errors.New("key: invalid arguments")
+
+	keyParamPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// KeyTemplateOptions 定义 key 模板可选参数
+type KeyTemplateOptions struct {
+	HashTag     string // 作为集群哈希标签的参数名，渲染为 {value}，使该参数相同的 key 落在同一哈希槽
+	Description string // 说明，供运维工具展示
+}
+
+// KeyFamily key 族信息，用于运维工具列出服务使用的全部 key
+type KeyFamily struct {
+	Name        string   // 名称
+	Pattern     string   // 定义时的模板，如 "user:{enterpriseId}:{uid}"
+	Glob        string   // 含命名空间的匹配模式，可用于 DelByPattern/ScanRedis，如 "order:user:*:*"
+	Params      []string // 参数名，按出现顺序
+	HashTag     string   // 作为哈希标签的参数名
+	Description string   // 说明
+}
+
+// KeyTemplate 类型化的 key 模板
+//
+// 模板中的 {name} 为参数，其余为字面量；构建时校验参数个数与取值，并自动加上命名空间前缀
+type KeyTemplate struct {
+	family  KeyFamily
+	prefix  string         // 命名空间前缀，如 "order:"
+	parts   []string       // 字面量片段，len(parts) == len(params)+1
+	matcher *regexp.Regexp // 用于 FamilyOf 反查
+}
+
+// KeyRegistry key 模板注册表
+//
+// 同一命名空间下的 key 族统一在此定义，避免不同服务共享 Redis 时 key 冲突
+type KeyRegistry struct {
+	namespace string
+	mu        sync.RWMutex
+	templates map[string]*KeyTemplate
+	order     []string
+}
+
+// NewKeyRegistry 创建 key 注册表，namespace 为应用命名空间（如服务名），为空时不加前缀
+func NewKeyRegistry(namespace string) *KeyRegistry {
+	return &KeyRegistry{namespace: namespace, templates: make(map[string]*KeyTemplate)}
+}
+
+// Keys 返回 Cache 的 key 注册表，命名空间取 CacheOptions.Namespace
+func (c *Cache) Keys() *KeyRegistry {
+	return c.keys
+}
+
+// Namespace 返回命名空间
+func (r *KeyRegistry) Namespace() string {
+	return r.namespace
+}
+
+// Define 定义 key 族
+//
+// 入参：name 为 key 族名称（注册表内唯一）；pattern 为模板，如 "user:{enterpriseId}:{uid}"
+func (r *KeyRegistry) Define(name, pattern string, options ...KeyTemplateOptions) (*KeyTemplate, error) {
+	var option KeyTemplateOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if name == "" || pattern == "" {
+		return nil, errors.New("key: name and pattern are required")
+	}
+
+	prefix := ""
+	if r.namespace != "" {
+		prefix = r.namespace + ":"
+	}
+	t := &KeyTemplate{
+		family: KeyFamily{Name: name, Pattern: pattern, HashTag: option.HashTag, Description: option.Description},
+		prefix: prefix,
+	}
+
+	// 拆分字面量与参数
+	last := 0
+	for _, loc := range keyParamPattern.FindAllStringSubmatchIndex(pattern, -1) {
+		param := pattern[loc[2]:loc[3]]
+		if contains(t.family.Params, param) {
+			return nil, fmt.Errorf("key: duplicate param %q in pattern %q", param, pattern)
+		}
+		t.parts = append(t.parts, pattern[last:loc[0]])
+		t.family.Params = append(t.family.Params, param)
+		last = loc[1]
+	}
+	t.parts = append(t.parts, pattern[last:])
+	for _, part := range t.parts {
+		if strings.ContainsAny(part, "{}") {
+			return nil, fmt.Errorf("key: invalid param syntax in pattern %q", pattern)
+		}
+	}
+	if option.HashTag != "" && !contains(t.family.Params, option.HashTag) {
+		return nil, fmt.Errorf("key: hash tag param %q not found in pattern %q", option.HashTag, pattern)
+	}
+
+	// 生成匹配模式与反查正则
+	var glob, re strings.Builder
+	glob.WriteString(escapeGlob(prefix))
+	re.WriteString("^" + regexp.QuoteMeta(prefix))
+	for i, param := range t.family.Params {
+		glob.WriteString(escapeGlob(t.parts[i]))
+		re.WriteString(regexp.QuoteMeta(t.parts[i]))
+		if param == option.HashTag {
+			glob.WriteString(`\{*\}`)
+			re.WriteString(`\{[^:{}]+\}`)
+		} else {
+			glob.WriteString("*")
+			re.WriteString(`[^:{}]+`)
+		}
+	}
+	glob.WriteString(escapeGlob(t.parts[len(t.parts)-1]))
+	re.WriteString(regexp.QuoteMeta(t.parts[len(t.parts)-1]) + "$")
+	t.family.Glob = glob.String()
+	t.matcher = regexp.MustCompile(re.String())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.templates[name]; ok {
+		if old.family.Pattern == pattern && old.family.HashTag == option.HashTag {
+			return old, nil
+		}
+		return nil, fmt.Errorf("key: family %q already defined with pattern %q", name, old.family.Pattern)
+	}
+	r.templates[name] = t
+	r.order = append(r.order, name)
+	return t, nil
+}
+
+// MustDefine 同 Define，出错时 panic，适用于包级变量初始化
+func (r *KeyRegistry) MustDefine(name, pattern string, options ...KeyTemplateOptions) *KeyTemplate {
+	t, err := r.Define(name, pattern, options...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Lookup 按名称查找 key 模板
+func (r *KeyRegistry) Lookup(name string) (*KeyTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.templates[name]
+	return t, ok
+}
+
+// Families 按名称排序返回全部 key 族
+func (r *KeyRegistry) Families() []KeyFamily {
+	r.mu.RLock()
+	families := make([]KeyFamily, 0, len(r.templates))
+	for _, name := range r.order {
+		families = append(families, r.templates[name].Family())
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// FamilyOf 返回 key 所属的 key 族名称，未匹配任何模板时返回空字符串
+func (r *KeyRegistry) FamilyOf(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range r.order {
+		if r.templates[name].matcher.MatchString(key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Family 返回 key 族信息
+func (t *KeyTemplate) Family() KeyFamily {
+	family := t.family
+	family.Params = append([]string(nil), t.family.Params...)
+	return family
+}
+
+// Key 按参数顺序构建 key
+//
+// 参数支持字符串与整数等基本类型（含具名类型），取值不能为空，也不能包含 ':'、'{'、'}' 或空白字符
+func (t *KeyTemplate) Key(args ...interface{}) (string, error) {
+	if len(args) != len(t.family.Params) {
+		return "", fmt.Errorf("%w: %s expects %d args (%s), got %d",
+			ErrKeyArgs, t.family.Name, len(t.family.Params), strings.Join(t.family.Params, ", "), len(args))
+	}
+	var b strings.Builder
+	b.WriteString(t.prefix)
+	for i, param := range t.family.Params {
+		value, err := formatKeyArg(args[i])
+		if err != nil {
+			return "", fmt.Errorf("%w: %s.%s: %v", ErrKeyArgs, t.family.Name, param, err)
+		}
+		b.WriteString(t.parts[i])
+		if param == t.family.HashTag {
+			b.WriteString("{" + value + "}")
+		} else {
+			b.WriteString(value)
+		}
+	}
+	b.WriteString(t.parts[len(t.parts)-1])
+	return b.String(), nil
+}
+
+// MustKey 同 Key，出错时 panic
+func (t *KeyTemplate) MustKey(args ...interface{}) string {
+	key, err := t.Key(args...)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// KeyMap 按参数名构建 key，多余或缺少的参数都会返回错误
+func (t *KeyTemplate) KeyMap(args map[string]interface{}) (string, error) {
+	if len(args) != len(t.family.Params) {
+		return "", fmt.Errorf("%w: %s expects params (%s)", ErrKeyArgs, t.family.Name, strings.Join(t.family.Params, ", "))
+	}
+	ordered := make([]interface{}, len(t.family.Params))
+	for i, param := range t.family.Params {
+		v, ok := args[param]
+		if !ok {
+			return "", fmt.Errorf("%w: %s missing param %s", ErrKeyArgs, t.family.Name, param)
+		}
+		ordered[i] = v
+	}
+	return t.Key(ordered...)
+}
+
+// formatKeyArg 将参数格式化为 key 片段并校验
+func formatKeyArg(arg interface{}) (string, error) {
+	if arg == nil {
+		return "", errors.New("nil value")
+	}
+	var s string
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.String:
+		s = rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Bool:
+		s = strconv.FormatBool(rv.Bool())
+	default:
+		return "", fmt.Errorf("unsupported type %T", arg)
+	}
+	if s == "" {
+		return "", errors.New("empty value")
+	}
+	if i := strings.IndexFunc(s, func(r rune) bool {
+		return r == ':' || r == '{' || r == '}' || r <= ' ' || r == 0x7f
+	}); i >= 0 {
+		return "", fmt.Errorf("invalid character %q in %q", s[i], s)
+	}
+	return s, nil
+}
+
+// escapeGlob 转义 Redis glob 特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
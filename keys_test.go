@@ -0,0 +1,88 @@
+package nie_test
+
+import (
+	"errors"
+	"testing"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+type enterpriseID int64
+
+func TestKeyTemplate(t *testing.T) {
+	c, _ := nietest.NewCache(t, nie.CacheOptions{Namespace: "order"})
+	keys := c.Keys()
+
+	user := keys.MustDefine("user", "user:{enterpriseId}:{uid}", nie.KeyTemplateOptions{Description: "用户信息"})
+	session := keys.MustDefine("session", "session:{uid}:{device}", nie.KeyTemplateOptions{HashTag: "uid"})
+
+	if key, err := user.Key(enterpriseID(7), "u1"); err != nil || key != "order:user:7:u1" {
+		t.Fatalf("Key = %q, %v", key, err)
+	}
+	if key := session.MustKey(42, "ios"); key != "order:session:{42}:ios" {
+		t.Fatalf("hash tag key = %q", key)
+	}
+	if key, err := user.KeyMap(map[string]interface{}{"uid": "u1", "enterpriseId": 7}); err != nil || key != "order:user:7:u1" {
+		t.Fatalf("KeyMap = %q, %v", key, err)
+	}
+
+	for _, args := range [][]interface{}{
+		{7},
+		{7, ""},
+		{7, "a:b"},
+		{7, "a b"},
+		{7, "{x}"},
+		{7, 1.5},
+		{nil, "u1"},
+	} {
+		if _, err := user.Key(args...); !errors.Is(err, nie.ErrKeyArgs) {
+			t.Fatalf("Key(%v) error = %v, want ErrKeyArgs", args, err)
+		}
+	}
+	if _, err := user.KeyMap(map[string]interface{}{"uid": "u1", "eid": 7}); !errors.Is(err, nie.ErrKeyArgs) {
+		t.Fatalf("KeyMap missing param error = %v", err)
+	}
+}
+
+func TestKeyRegistry(t *testing.T) {
+	keys := nie.NewKeyRegistry("order")
+	keys.MustDefine("user", "user:{enterpriseId}:{uid}")
+	keys.MustDefine("session", "session:{uid}:{device}", nie.KeyTemplateOptions{HashTag: "uid"})
+
+	if _, err := keys.Define("user", "user:{uid}"); err == nil {
+		t.Fatal("redefining family with another pattern should fail")
+	}
+	if _, err := keys.Define("user", "user:{enterpriseId}:{uid}"); err != nil {
+		t.Fatalf("redefining identical family error: %v", err)
+	}
+	for _, pattern := range []string{"a:{x}:{x}", "a:{x", "a:{1x}"} {
+		if _, err := keys.Define("bad", pattern); err == nil {
+			t.Fatalf("Define(%q) should fail", pattern)
+		}
+	}
+	if _, err := keys.Define("bad", "a:{x}", nie.KeyTemplateOptions{HashTag: "y"}); err == nil {
+		t.Fatal("unknown hash tag param should fail")
+	}
+
+	families := keys.Families()
+	if len(families) != 2 || families[0].Name != "session" || families[1].Name != "user" {
+		t.Fatalf("Families = %+v", families)
+	}
+	if families[0].Glob != `order:session:\{*\}:*` || families[1].Glob != "order:user:*:*" {
+		t.Fatalf("Glob = %q, %q", families[0].Glob, families[1].Glob)
+	}
+
+	cases := map[string]string{
+		"order:user:7:u1":        "user",
+		"order:session:{42}:ios": "session",
+		"order:session:42:ios":   "",
+		"billing:user:7:u1":      "",
+		"order:user:7":           "",
+	}
+	for key, want := range cases {
+		if got := keys.FamilyOf(key); got != want {
+			t.Fatalf("FamilyOf(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
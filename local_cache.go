@@ -0,0 +1,115 @@
+package nie
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// pttlNoExpire PTTL 对未设置过期时间的 key 返回的值
+const pttlNoExpire = time.Duration(-1)
+
+// localCache 进程内 LRU 缓存，按容量淘汰最久未使用的条目，每个条目带独立过期时间
+//
+// 存储 Redis 中的原始字节，解码规则与直接读取 Redis 保持一致
+type localCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	ll       *list.List               // 头部为最近使用
+	items    map[string]*list.Element // key -> *localEntry
+}
+
+type localEntry struct {
+	key      string
+	data     []byte
+	expireAt time.Time
+}
+
+func newLocalCache(capacity int, ttl time.Duration, now func() time.Time) *localCache {
+	return &localCache{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      now,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// get 读取条目，过期条目会被删除并视为未命中
+func (l *localCache) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*localEntry)
+	if !l.now().Before(entry.expireAt) {
+		l.removeElement(el)
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return entry.data, true
+}
+
+// set 写入条目，超出容量时淘汰最久未使用的条目
+//
+// ttl 为 key 在 Redis 中的剩余过期时间（PTTL），条目过期时间取其与 l.ttl 的较小值；
+// ttl 为 -1（永不过期）时使用 l.ttl，其他不大于 0 的值表示 key 已过期或不存在，不写入
+func (l *localCache) set(key string, data []byte, ttl time.Duration) {
+	if ttl != pttlNoExpire {
+		if ttl <= 0 {
+			return
+		}
+		ttl = min(ttl, l.ttl)
+	} else {
+		ttl = l.ttl
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expireAt := l.now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*localEntry)
+		entry.data = data
+		entry.expireAt = expireAt
+		l.ll.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&localEntry{key: key, data: data, expireAt: expireAt})
+	for l.ll.Len() > l.capacity {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+// del 删除条目
+func (l *localCache) del(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.removeElement(el)
+		}
+	}
+}
+
+// purge 清空全部条目
+func (l *localCache) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ll.Init()
+	l.items = make(map[string]*list.Element, l.capacity)
+}
+
+// len 返回当前条目数（含尚未清理的过期条目）
+func (l *localCache) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *localCache) removeElement(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*localEntry).key)
+}
@@ -0,0 +1,275 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotAcquired 在等待时间内未能获取到锁
+	ErrLockNotAcquired = errors.New("lock: not acquired")
+	// ErrLockNotHeld 释放或续期时锁已不属于当前持有者（已过期或被他人获取）
+	ErrLockNotHeld = errors.New("lock: not held")
+	// errLockAlreadyHeld 同一个 Mutex 重复加锁（Mutex 不可重入）
+	errLockAlreadyHeld = errors.New("lock: already held by this mutex")
+)
+
+const (
+	defaultLockTTL           = 30 * time.Second
+	defaultLockRetryInterval = 100 * time.Millisecond
+)
+
+// unlockScript 仅当 value 与持有者 token 一致时删除 key
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// extendScript 仅当 value 与持有者 token 一致时重置过期时间（毫秒）
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// MutexOptions 定义分布式锁可选参数
+type MutexOptions struct {
+	TTL           time.Duration // 锁租约时长，默认 30s
+	RetryInterval time.Duration // 获取失败后的重试间隔，默认 100ms
+	WaitTimeout   time.Duration // Lock 的最长等待时间，0 表示一直等待到 ctx 结束
+	DisableRenew  bool          // 关闭自动续期；默认持有期间每 TTL/3 续期一次
+}
+
+// Mutex 基于 Redis 的分布式互斥锁
+//
+// 加锁使用 SET NX PX 写入随机 token，释放与续期通过 Lua 校验 token，避免误删他人的锁。
+// 只操作单个 key，可用于单机与集群客户端。Mutex 不可重入，也不应在多个 goroutine 间共享加锁。
+type Mutex struct {
+	c       *Cache
+	key     string
+	options MutexOptions
+
+	mu    sync.Mutex
+	token string        // 当前持有的 token，空表示未持有
+	stop  chan struct{} // 通知续期协程退出
+	lost  chan struct{} // 续期失败（锁已丢失）时关闭
+}
+
+// NewMutex 创建分布式锁，key 为锁在 Redis 中的 key
+func (c *Cache) NewMutex(key string, options ...MutexOptions) *Mutex {
+	var option MutexOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.TTL <= 0 {
+		option.TTL = defaultLockTTL
+	}
+	if option.RetryInterval <= 0 {
+		option.RetryInterval = defaultLockRetryInterval
+	}
+	return &Mutex{c: c, key: key, options: option}
+}
+
+// TryLock 尝试获取一次锁，获取成功返回 true
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != "" {
+		return false, errLockAlreadyHeld
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return false, err
+	}
+	ok, err := m.c.redis.SetNX(ctx, m.key, token, m.options.TTL).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	m.token = token
+	m.lost = make(chan struct{})
+	if !m.options.DisableRenew {
+		m.stop = make(chan struct{})
+		go m.renew(token, m.stop, m.lost)
+	}
+	return true, nil
+}
+
+// Lock 获取锁，获取失败时按 RetryInterval 重试
+//
+// 超过 WaitTimeout 仍未获取到返回 ErrLockNotAcquired；ctx 结束时返回 ctx.Err()
+func (m *Mutex) Lock(ctx context.Context) error {
+	waitCtx := ctx
+	if m.options.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, m.options.WaitTimeout)
+		defer cancel()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ErrLockNotAcquired
+		case <-timer.C:
+		}
+
+		ok, err := m.TryLock(waitCtx)
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				return ErrLockNotAcquired
+			}
+			return err
+		}
+		if ok {
+			return nil
+		}
+		timer.Reset(m.options.RetryInterval)
+	}
+}
+
+// Unlock 释放锁，锁已过期或被他人持有时返回 ErrLockNotHeld
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	token := m.token
+	m.release()
+	m.mu.Unlock()
+	if token == "" {
+		return ErrLockNotHeld
+	}
+
+	n, err := unlockScript.Run(ctx, m.c.redis, []string{m.key}, token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend 手动续期，将锁的剩余时间重置为 ttl
+func (m *Mutex) Extend(ctx context.Context, ttl time.Duration) error {
+	m.mu.Lock()
+	token := m.token
+	m.mu.Unlock()
+	if token == "" {
+		return ErrLockNotHeld
+	}
+
+	ok, err := m.extend(ctx, token, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Lost 返回一个在自动续期发现锁已丢失时关闭的通道；未持有锁时返回 nil
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+// WithLock 在持有锁期间执行 fn
+//
+// 传给 fn 的 ctx 会在锁丢失（续期失败）或外部 ctx 结束时取消，fn 应据此尽快退出。
+// fn 返回后无论成功与否都会释放锁；获取锁失败时不执行 fn 并返回对应错误。
+func (c *Cache) WithLock(ctx context.Context, key string, fn func(ctx context.Context) error, options ...MutexOptions) error {
+	m := c.NewMutex(key, options...)
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		// 使用独立上下文释放锁，避免外部 ctx 已取消导致锁只能等待过期
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := m.Unlock(unlockCtx); err != nil && !errors.Is(err, ErrLockNotHeld) {
+			c.logf("unlock failed for key %s: %v", key, err)
+		}
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := m.Lost()
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+	return fn(fnCtx)
+}
+
+// renew 自动续期，直到 stop 关闭或发现锁已丢失
+//
+// 单次续期失败（网络错误）不会立即判定丢锁，只有距上次成功续期已超过 TTL 才关闭 lost
+func (m *Mutex) renew(token string, stop <-chan struct{}, lost chan struct{}) {
+	interval := m.options.TTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastRenewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ok, err := m.extend(ctx, token, m.options.TTL)
+		cancel()
+		switch {
+		case err != nil:
+			m.c.logf("renew lock failed for key %s: %v", m.key, err)
+			if time.Since(lastRenewed) < m.options.TTL {
+				continue
+			}
+		case ok:
+			lastRenewed = time.Now()
+			continue
+		}
+		close(lost)
+		return
+	}
+}
+
+// extend 校验 token 并重置过期时间
+func (m *Mutex) extend(ctx context.Context, token string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(ctx, m.c.redis, []string{m.key}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// release 清理本地持有状态并停止续期，调用方需持有 m.mu
+func (m *Mutex) release() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	m.token = ""
+	m.lost = nil
+}
+
+// newLockToken 生成随机 token，用于标识锁的持有者
+func newLockToken() (string, error) {
+	return randomHex(16)
+}
@@ -0,0 +1,126 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+)
+
+func TestMutex(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	m1 := c.NewMutex("lock:order:1")
+	m2 := c.NewMutex("lock:order:1", nie.MutexOptions{WaitTimeout: 50 * time.Millisecond, RetryInterval: 10 * time.Millisecond})
+	if ok, err := m1.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("m1 TryLock = %v, %v", ok, err)
+	}
+	if err := m2.Lock(ctx); !errors.Is(err, nie.ErrLockNotAcquired) {
+		t.Fatalf("m2 Lock error = %v, want ErrLockNotAcquired", err)
+	}
+	if err := m2.Unlock(ctx); !errors.Is(err, nie.ErrLockNotHeld) {
+		t.Fatalf("m2 Unlock error = %v, want ErrLockNotHeld", err)
+	}
+	if err := m1.Unlock(ctx); err != nil {
+		t.Fatalf("m1 Unlock error: %v", err)
+	}
+	if err := m2.Lock(ctx); err != nil {
+		t.Fatalf("m2 Lock after release error: %v", err)
+	}
+	if err := m2.Unlock(ctx); err != nil {
+		t.Fatalf("m2 Unlock error: %v", err)
+	}
+
+	var ran bool
+	err := c.WithLock(ctx, "lock:job", func(ctx context.Context) error {
+		ran = true
+		if ok, _ := c.NewMutex("lock:job").TryLock(ctx); ok {
+			t.Error("lock should be held inside WithLock")
+		}
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("WithLock = %v, ran = %v", err, ran)
+	}
+	if ok, _ := c.NewMutex("lock:job").TryLock(ctx); !ok {
+		t.Fatal("lock should be released after WithLock")
+	}
+}
+
+func TestMutex_ExpiryAndExtend(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	m := c.NewMutex("lock:k", nie.MutexOptions{TTL: time.Second, DisableRenew: true})
+	if ok, err := m.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	// Mutex 不可重入
+	if ok, err := m.TryLock(ctx); err == nil || ok {
+		t.Fatalf("reentrant TryLock = %v, %v", ok, err)
+	}
+	if err := m.Extend(ctx, time.Minute); err != nil || s.TTL("lock:k") != time.Minute {
+		t.Fatalf("Extend error = %v, ttl = %v", err, s.TTL("lock:k"))
+	}
+
+	// 锁过期后被他人获取，原持有者无法续期或释放他人的锁
+	s.FastForward(time.Minute)
+	other := c.NewMutex("lock:k", nie.MutexOptions{DisableRenew: true})
+	if ok, err := other.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("other TryLock = %v, %v", ok, err)
+	}
+	if err := m.Extend(ctx, time.Minute); !errors.Is(err, nie.ErrLockNotHeld) {
+		t.Fatalf("Extend error = %v, want ErrLockNotHeld", err)
+	}
+	if err := m.Unlock(ctx); !errors.Is(err, nie.ErrLockNotHeld) {
+		t.Fatalf("Unlock error = %v, want ErrLockNotHeld", err)
+	}
+	if !s.Exists("lock:k") {
+		t.Fatal("Unlock should not delete a lock held by another owner")
+	}
+}
+
+func TestMutex_Renew(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	m := c.NewMutex("lock:renew", nie.MutexOptions{TTL: 300 * time.Millisecond})
+	if ok, err := m.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	defer m.Unlock(ctx)
+
+	s.FastForward(250 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for s.TTL("lock:renew") != 300*time.Millisecond {
+		if time.Now().After(deadline) {
+			t.Fatalf("lock was not renewed, ttl = %v", s.TTL("lock:renew"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithLock_LostCancelsContext(t *testing.T) {
+	c, s := newTestCache(t)
+	ctx := context.Background()
+
+	err := c.WithLock(ctx, "lock:lost", func(ctx context.Context) error {
+		// 锁被他人抢占后续期失败，fn 的 ctx 被取消
+		s.Set("lock:lost", "other")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("ctx was not canceled after lock was lost")
+		}
+	}, nie.MutexOptions{TTL: 60 * time.Millisecond})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WithLock error = %v, want context.Canceled", err)
+	}
+	if v, _ := s.Get("lock:lost"); v != "other" {
+		t.Fatalf("lock held by another owner should remain, got %q", v)
+	}
+}
@@ -0,0 +1,83 @@
+package nietest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestRedis_Advance(t *testing.T) {
+	r := nietest.NewRedis(t)
+	ctx := context.Background()
+
+	start := r.Now()
+	if err := r.Client().Set(ctx, "k", "v", time.Minute).Err(); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	r.Advance(59 * time.Second)
+	if got := r.Now().Sub(start); got != 59*time.Second {
+		t.Fatalf("Now advanced %v, want 59s", got)
+	}
+	if ttl := r.Server().TTL("k"); ttl != time.Second {
+		t.Fatalf("ttl = %v, want 1s", ttl)
+	}
+	r.Advance(time.Second)
+	if err := r.Client().Get(ctx, "k").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("key should be expired, got %v", err)
+	}
+}
+
+func TestNewCache_ExpirationWithClock(t *testing.T) {
+	c, r := nietest.NewCache(t, nie.CacheOptions{Local: &nie.LocalCacheOptions{TTL: time.Hour}})
+	ctx := context.Background()
+
+	if err := c.SetRedis(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatalf("SetRedis error: %v", err)
+	}
+	r.Advance(59 * time.Second)
+	if _, err := c.GetRedis(ctx, "k"); err != nil {
+		t.Fatalf("key should still exist: %v", err)
+	}
+	if err := c.TTLRefresh(ctx, "k", time.Minute); err != nil {
+		t.Fatalf("TTLRefresh error: %v", err)
+	}
+	r.Advance(59 * time.Second)
+	if _, err := c.GetRedis(ctx, "k"); err != nil {
+		t.Fatalf("key should exist after refresh: %v", err)
+	}
+
+	// 一级缓存使用同一时钟，推进超过本地 TTL 后重新读取 Redis
+	r.Server().Del("k")
+	if _, err := c.GetRedis(ctx, "k"); err != nil {
+		t.Fatalf("local entry should still be served: %v", err)
+	}
+	r.Advance(time.Hour)
+	if _, err := c.GetRedis(ctx, "k"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("key should be expired, got %v", err)
+	}
+}
+
+func TestInitCache(t *testing.T) {
+	old := nie.DefaultCache
+	t.Run("init", func(t *testing.T) {
+		nietest.InitCache(t)
+		ctx := context.Background()
+		if nie.DefaultCache == old {
+			t.Fatal("DefaultCache should be replaced")
+		}
+		if err := nie.DefaultCache.SetRedis(ctx, "k", 1, 0); err != nil {
+			t.Fatalf("SetRedis error: %v", err)
+		}
+		if v, err := nie.DefaultCache.GetRedis(ctx, "k"); err != nil || v != "1" {
+			t.Fatalf("GetRedis = %q, %v", v, err)
+		}
+	})
+	if nie.DefaultCache != old {
+		t.Fatal("DefaultCache should be restored after the test")
+	}
+}
@@ -0,0 +1,375 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/peer"
+)
+
+// ErrRateLimited 请求超过限流阈值，对应 HTTP 429
+var ErrRateLimited = kerrors.New(http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "请求过于频繁，请稍后再试")
+
+const defaultRateLimitPrefix = "ratelimit:"
+
+// RateLimitAlgorithm 限流算法
+type RateLimitAlgorithm int
+
+const (
+	// FixedWindow 固定窗口计数：首个请求开启窗口，窗口内最多 Limit 次
+	FixedWindow RateLimitAlgorithm = iota
+	// SlidingWindowLog 滑动窗口日志：记录每次请求的时间，任意 Period 内最多 Limit 次，精确但占用内存与请求数成正比
+	SlidingWindowLog
+	// TokenBucket 令牌桶：每 Period 补充 Limit 个令牌，桶容量为 Burst，允许短时突发
+	TokenBucket
+)
+
+// fixedWindowScript 固定窗口计数，超限的请求不计数
+//
+// KEYS[1] 计数 key；ARGV[1] 上限；ARGV[2] 本次消耗；ARGV[3] 窗口长度（毫秒）。
+// 返回 {是否允许, 剩余次数, 重试等待（毫秒）}
+var fixedWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local n = tonumber(ARGV[2])
+local cur = tonumber(redis.call("get", KEYS[1]) or "0")
+if cur + n > limit then
+	local ttl = redis.call("pttl", KEYS[1])
+	if ttl < 0 then
+		ttl = tonumber(ARGV[3])
+		redis.call("pexpire", KEYS[1], ttl)
+	end
+	return {0, limit - cur, ttl}
+end
+cur = redis.call("incrby", KEYS[1], n)
+if redis.call("pttl", KEYS[1]) < 0 then
+	redis.call("pexpire", KEYS[1], ARGV[3])
+end
+return {1, limit - cur, 0}
+`)
+
+// slidingWindowScript 滑动窗口日志，使用有序集合记录请求时间
+//
+// KEYS[1] 有序集合；ARGV[1] 上限；ARGV[2] 本次消耗；ARGV[3] 窗口长度（毫秒）；ARGV[4] 当前时间（毫秒）；ARGV[5] 成员唯一前缀。
+// 返回 {是否允许, 剩余次数, 重试等待（毫秒）}
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local n = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - period)
+local count = redis.call("zcard", KEYS[1])
+if count + n > limit then
+	local oldest = redis.call("zrange", KEYS[1], count + n - limit - 1, count + n - limit - 1, "withscores")
+	local retry = period
+	if oldest[2] then
+		retry = tonumber(oldest[2]) + period - now
+	end
+	return {0, limit - count, retry}
+end
+for i = 1, n do
+	redis.call("zadd", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+redis.call("pexpire", KEYS[1], period)
+return {1, limit - count - n, 0}
+`)
+
+// tokenBucketScript 令牌桶，按上次请求以来经过的时间补充令牌
+//
+// KEYS[1] 哈希（tokens、ts）；ARGV[1] 桶容量；ARGV[2] 每毫秒补充的令牌数；ARGV[3] 本次消耗；ARGV[4] 当前时间（毫秒）。
+// 返回 {是否允许, 剩余令牌, 重试等待（毫秒）}
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local data = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate)
+end
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("pexpire", KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry}
+`)
+
+// RateLimit 限流规则
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm // 限流算法，默认 FixedWindow
+	Limit     int64              // 每个 Period 允许的请求数
+	Period    time.Duration      // 统计周期
+	Burst     int64              // 令牌桶容量，默认等于 Limit，仅 TokenBucket 使用
+}
+
+// RateLimiterOptions 定义限流器可选参数
+type RateLimiterOptions struct {
+	Prefix string // 计数 key 前缀，默认 "<Namespace>:ratelimit:"；不同规则共用 Redis 时应使用不同前缀
+}
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed    bool          // 是否允许
+	Limit      int64         // 规则上限（令牌桶为桶容量）
+	Remaining  int64         // 剩余可用次数
+	RetryAfter time.Duration // 被拒绝时距离可再次请求的等待时间，允许时为 0
+}
+
+// RateLimiter 基于 Redis 的分布式限流器
+//
+// 每次判断都是单 key 的 Lua 脚本，计数与判断原子完成，可用于集群客户端。
+// 滑动窗口与令牌桶依赖调用方时钟（CacheOptions.Now），多实例部署时应保证时钟同步
+type RateLimiter struct {
+	c      *Cache
+	limit  RateLimit
+	prefix string
+}
+
+// NewRateLimiter 创建限流器，Limit 需大于 0，Period 不能小于 1ms（Redis 过期时间的精度）
+func (c *Cache) NewRateLimiter(limit RateLimit, options ...RateLimiterOptions) (*RateLimiter, error) {
+	if limit.Limit <= 0 {
+		return nil, errors.New("ratelimit: limit must be positive")
+	}
+	if limit.Period < time.Millisecond {
+		return nil, fmt.Errorf("ratelimit: period must be at least 1ms, got %s", limit.Period)
+	}
+	if limit.Algorithm > TokenBucket || limit.Algorithm < FixedWindow {
+		return nil, fmt.Errorf("ratelimit: unknown algorithm %d", limit.Algorithm)
+	}
+	var option RateLimiterOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Prefix == "" {
+		option.Prefix = defaultRateLimitPrefix
+		if ns := c.keys.Namespace(); ns != "" {
+			option.Prefix = ns + ":" + defaultRateLimitPrefix
+		}
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Limit
+	}
+	return &RateLimiter{c: c, limit: limit, prefix: option.Prefix}, nil
+}
+
+// Allow 判断 key 的一次请求是否允许
+func (l *RateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN 判断 key 的 n 次请求是否允许，允许时一次性扣除 n 次；被拒绝的请求不计数
+func (l *RateLimiter) AllowN(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	capacity := l.limit.Limit
+	if l.limit.Algorithm == TokenBucket {
+		capacity = l.limit.Burst
+	}
+	if n <= 0 || n > capacity {
+		return nil, fmt.Errorf("ratelimit: n must be in [1, %d], got %d", capacity, n)
+	}
+
+	keys := []string{l.prefix + key}
+	period := l.limit.Period.Milliseconds()
+	now := l.c.now().UnixMilli()
+	var cmd *redis.Cmd
+	switch l.limit.Algorithm {
+	case FixedWindow:
+		cmd = fixedWindowScript.Run(ctx, l.c.redis, keys, l.limit.Limit, n, period)
+	case SlidingWindowLog:
+		member, err := randomHex(8)
+		if err != nil {
+			return nil, err
+		}
+		cmd = slidingWindowScript.Run(ctx, l.c.redis, keys, l.limit.Limit, n, period, now, member)
+	case TokenBucket:
+		rate := strconv.FormatFloat(float64(l.limit.Limit)/float64(period), 'g', -1, 64)
+		cmd = tokenBucketScript.Run(ctx, l.c.redis, keys, l.limit.Burst, rate, n, now)
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown algorithm %d", l.limit.Algorithm)
+	}
+	values, err := cmd.Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("ratelimit: unexpected script result %v", values)
+	}
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      capacity,
+		Remaining:  max(values[1], 0),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// Reset 清除 key 的限流计数
+func (l *RateLimiter) Reset(ctx context.Context, key string) error {
+	return l.c.redis.Del(ctx, l.prefix+key).Err()
+}
+
+// RateLimitKeyFunc 从请求上下文中取限流 key，返回 false 时该请求不限流
+type RateLimitKeyFunc func(ctx context.Context) (string, bool)
+
+// RateLimitByUid 按用户ID限流，未登录（uid 为 0）的请求不限流
+func RateLimitByUid(ctx context.Context) (string, bool) {
+	uid := CtxUid(ctx)
+	return "uid:" + strconv.FormatInt(uid, 10), uid != 0
+}
+
+// RateLimitByEnterpriseId 按企业ID限流，企业ID为 0 的请求不限流
+func RateLimitByEnterpriseId(ctx context.Context) (string, bool) {
+	id := CtxEnterpriseId(ctx)
+	return "enterprise:" + strconv.FormatInt(id, 10), id != 0
+}
+
+// ClientIPOptions 定义获取客户端 IP 的可选参数
+type ClientIPOptions struct {
+	// TrustedProxies 受信任的代理网段，连接地址属于其中时才读取 X-Forwarded-For / X-Real-IP；
+	// X-Forwarded-For 从右向左跳过受信任的代理，取第一个不受信任的地址
+	TrustedProxies []netip.Prefix
+}
+
+// RateLimitByIP 按客户端 IP 限流，取连接地址（HTTP 为 RemoteAddr，gRPC 为 peer 地址）
+//
+// 不读取可被客户端伪造的 X-Forwarded-For / X-Real-IP，部署在代理之后时使用 RateLimitByClientIP
+func RateLimitByIP(ctx context.Context) (string, bool) {
+	ip := clientIP(ctx, nil)
+	return "ip:" + ip, ip != ""
+}
+
+// RateLimitByClientIP 按客户端 IP 限流，仅信任来自 ClientIPOptions.TrustedProxies 的转发请求头
+func RateLimitByClientIP(options ...ClientIPOptions) RateLimitKeyFunc {
+	var option ClientIPOptions
+	if len(options) > 0 {
+		option = options[0]
+	}
+	return func(ctx context.Context) (string, bool) {
+		ip := clientIP(ctx, option.TrustedProxies)
+		return "ip:" + ip, ip != ""
+	}
+}
+
+// RateLimitByOperation 在 key 前加上接口名，使同一个限流器对每个接口分别计数
+func RateLimitByOperation(keyFunc RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(ctx context.Context) (string, bool) {
+		key, ok := keyFunc(ctx)
+		if !ok {
+			return "", false
+		}
+		if tr, has := transport.FromServerContext(ctx); has {
+			return tr.Operation() + ":" + key, true
+		}
+		return key, true
+	}
+}
+
+// RateLimitMiddleware Kratos 服务端限流中间件
+//
+// 超限时返回 ErrRateLimited，并在响应头写入 Retry-After（秒）与 X-RateLimit-Remaining。
+// Redis 不可用时放行请求（失败开放）并通过 CacheOptions.LogHelper 记录错误
+func RateLimitMiddleware(limiter *RateLimiter, keyFunc RateLimitKeyFunc) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			key, ok := keyFunc(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			res, err := limiter.Allow(ctx, key)
+			if err != nil {
+				limiter.c.logf("rate limit check failed for key %s: %v", key, err)
+				return handler(ctx, req)
+			}
+			if tr, has := transport.FromServerContext(ctx); has {
+				tr.ReplyHeader().Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+				if !res.Allowed {
+					tr.ReplyHeader().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(res.RetryAfter.Seconds())), 10))
+				}
+			}
+			if !res.Allowed {
+				return nil, ErrRateLimited
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// clientIP 获取客户端 IP，取不到时返回空字符串
+//
+// 连接地址属于 trusted 时依次取 X-Forwarded-For 中最右侧的非代理地址、X-Real-IP，否则直接使用连接地址
+func clientIP(ctx context.Context, trusted []netip.Prefix) string {
+	var remote string
+	tr, hasTransport := transport.FromServerContext(ctx)
+	// Kratos HTTP 传输层提供原始请求
+	if r, ok := tr.(interface{ Request() *http.Request }); hasTransport && ok && r.Request() != nil {
+		remote = hostOf(r.Request().RemoteAddr)
+	} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = hostOf(p.Addr.String())
+	}
+	if !hasTransport || !isTrustedProxy(remote, trusted) {
+		return remote
+	}
+
+	header := tr.RequestHeader()
+	if xff := header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if ip == "" {
+				continue
+			}
+			if i == 0 || !isTrustedProxy(ip, trusted) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return remote
+}
+
+// isTrustedProxy 判断地址是否属于受信任的代理网段
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOf 去掉地址中的端口
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
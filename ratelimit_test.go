@@ -0,0 +1,212 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+type testHeader http.Header
+
+func (h testHeader) Get(key string) string      { return http.Header(h).Get(key) }
+func (h testHeader) Set(key, value string)      { http.Header(h).Set(key, value) }
+func (h testHeader) Add(key, value string)      { http.Header(h).Add(key, value) }
+func (h testHeader) Values(key string) []string { return http.Header(h).Values(key) }
+func (h testHeader) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type testTransport struct {
+	operation  string
+	request    testHeader
+	reply      testHeader
+	remoteAddr string
+}
+
+func newTestTransport(operation string) *testTransport {
+	return &testTransport{operation: operation, request: testHeader{}, reply: testHeader{}}
+}
+
+func (t *testTransport) Kind() transport.Kind            { return transport.KindHTTP }
+func (t *testTransport) Endpoint() string                { return "" }
+func (t *testTransport) Operation() string               { return t.operation }
+func (t *testTransport) RequestHeader() transport.Header { return t.request }
+func (t *testTransport) ReplyHeader() transport.Header   { return t.reply }
+func (t *testTransport) Request() *http.Request          { return &http.Request{RemoteAddr: t.remoteAddr} }
+
+func TestRateLimiter_FixedWindow(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	limiter, err := c.NewRateLimiter(nie.RateLimit{Limit: 3, Period: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+
+	for i := int64(2); i >= 0; i-- {
+		res, err := limiter.Allow(ctx, "sms:13800000000")
+		if err != nil || !res.Allowed || res.Remaining != i {
+			t.Fatalf("Allow = %+v, %v", res, err)
+		}
+	}
+	res, err := limiter.Allow(ctx, "sms:13800000000")
+	if err != nil || res.Allowed || res.RetryAfter != time.Minute {
+		t.Fatalf("over limit = %+v, %v", res, err)
+	}
+	r.Advance(time.Minute)
+	if res, _ := limiter.Allow(ctx, "sms:13800000000"); !res.Allowed {
+		t.Fatal("new window should allow")
+	}
+	if _, err := limiter.AllowN(ctx, "k", 4); err == nil {
+		t.Fatal("AllowN above limit should fail")
+	}
+}
+
+func TestNewRateLimiter_InvalidLimit(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	for _, limit := range []nie.RateLimit{
+		{Limit: 0, Period: time.Second},
+		{Limit: 1, Period: time.Microsecond},
+		{Algorithm: nie.TokenBucket, Limit: 1, Period: 999 * time.Microsecond},
+		{Algorithm: nie.RateLimitAlgorithm(9), Limit: 1, Period: time.Second},
+	} {
+		if _, err := c.NewRateLimiter(limit); err == nil {
+			t.Fatalf("NewRateLimiter(%+v) should fail", limit)
+		}
+	}
+}
+
+func TestRateLimiter_SlidingWindowLog(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	limiter, err := c.NewRateLimiter(nie.RateLimit{Algorithm: nie.SlidingWindowLog, Limit: 2, Period: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+
+	limiter.Allow(ctx, "login")
+	r.Advance(4 * time.Second)
+	limiter.Allow(ctx, "login")
+	r.Advance(4 * time.Second)
+	res, err := limiter.Allow(ctx, "login")
+	if err != nil || res.Allowed || res.RetryAfter != 2*time.Second {
+		t.Fatalf("over limit = %+v, %v", res, err)
+	}
+	r.Advance(2 * time.Second)
+	if res, _ := limiter.Allow(ctx, "login"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("oldest request left the window, got %+v", res)
+	}
+}
+
+func TestRateLimitByClientIP(t *testing.T) {
+	keyFunc := nie.RateLimitByClientIP(nie.ClientIPOptions{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+	for _, tc := range []struct {
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"1.1.1.1:5000", "3.3.3.3", "", "ip:1.1.1.1"},
+		{"10.0.0.1:5000", "", "", "ip:10.0.0.1"},
+		{"10.0.0.1:5000", "3.3.3.3, 2.2.2.2, 10.0.0.2", "", "ip:2.2.2.2"},
+		{"10.0.0.1:5000", "10.0.0.3, 10.0.0.2", "", "ip:10.0.0.3"},
+		{"10.0.0.1:5000", "", "4.4.4.4", "ip:4.4.4.4"},
+	} {
+		tr := newTestTransport("/a")
+		tr.remoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			tr.request.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			tr.request.Set("X-Real-IP", tc.realIP)
+		}
+		key, ok := keyFunc(transport.NewServerContext(context.Background(), tr))
+		if !ok || key != tc.want {
+			t.Fatalf("RateLimitByClientIP(%s, xff=%q, real=%q) = %q, %v, want %q", tc.remoteAddr, tc.xff, tc.realIP, key, ok, tc.want)
+		}
+	}
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+	limiter, err := c.NewRateLimiter(nie.RateLimit{Algorithm: nie.TokenBucket, Limit: 1, Period: time.Second, Burst: 3})
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+
+	if res, err := limiter.AllowN(ctx, "export", 3); err != nil || !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("burst = %+v, %v", res, err)
+	}
+	res, err := limiter.AllowN(ctx, "export", 2)
+	if err != nil || res.Allowed || res.RetryAfter != 2*time.Second {
+		t.Fatalf("empty bucket = %+v, %v", res, err)
+	}
+	r.Advance(2 * time.Second)
+	if res, _ := limiter.AllowN(ctx, "export", 2); !res.Allowed {
+		t.Fatalf("refilled bucket = %+v", res)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	c, _ := nietest.NewCache(t)
+	limiter, err := c.NewRateLimiter(nie.RateLimit{Limit: 1, Period: time.Minute})
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+	handler := nie.RateLimitMiddleware(limiter, nie.RateLimitByOperation(nie.RateLimitByIP))(
+		func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil })
+
+	call := func(operation, remoteAddr string) (*testTransport, error) {
+		tr := newTestTransport(operation)
+		tr.remoteAddr = remoteAddr
+		_, err := handler(transport.NewServerContext(context.Background(), tr), nil)
+		return tr, err
+	}
+	if _, err := call("/a", "1.1.1.1:5000"); err != nil {
+		t.Fatalf("first call error: %v", err)
+	}
+	tr, err := call("/a", "1.1.1.1:5001")
+	if !errors.Is(err, nie.ErrRateLimited) || kerrors.Code(err) != http.StatusTooManyRequests {
+		t.Fatalf("second call error = %v", err)
+	}
+	if tr.reply.Get("Retry-After") != "60" {
+		t.Fatalf("Retry-After = %q", tr.reply.Get("Retry-After"))
+	}
+	if _, err := call("/b", "1.1.1.1:5000"); err != nil {
+		t.Fatalf("other operation should be counted separately: %v", err)
+	}
+	if _, err := call("/a", "2.2.2.2:5000"); err != nil {
+		t.Fatalf("other ip should be counted separately: %v", err)
+	}
+
+	// 默认不信任转发请求头，伪造 X-Forwarded-For 不能绕过限流
+	tr = newTestTransport("/a")
+	tr.remoteAddr = "1.1.1.1:5002"
+	tr.request.Set("X-Forwarded-For", "3.3.3.3")
+	if _, err := handler(transport.NewServerContext(context.Background(), tr), nil); !errors.Is(err, nie.ErrRateLimited) {
+		t.Fatalf("spoofed X-Forwarded-For error = %v", err)
+	}
+
+	// 未登录请求不按用户限流
+	byUid := nie.RateLimitMiddleware(limiter, nie.RateLimitByUid)(
+		func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil })
+	for i := 0; i < 3; i++ {
+		if _, err := byUid(context.Background(), nil); err != nil {
+			t.Fatalf("anonymous call error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package nie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+)
+
+// errConsumerStarted 同一个 Consumer 重复启动
+var errConsumerStarted = errors.New("stream: consumer already started")
+
+const (
+	streamDataField = "data"
+
+	defaultConsumerBatchSize     = 10
+	defaultConsumerBlock         = 2 * time.Second
+	defaultConsumerClaimIdle     = time.Minute
+	defaultConsumerMaxDeliveries = 5
+	defaultDeadLetterSuffix      = ":dead"
+)
+
+var _ transport.Server = (*Consumer)(nil)
+
+// PublishOptions 定义 Publish 可选参数
+type PublishOptions struct {
+	MaxLen int64 // 大于 0 时近似裁剪 Stream，只保留最近约 MaxLen 条消息
+}
+
+// StreamMessage 消费到的消息
+type StreamMessage struct {
+	ID         string                 // 消息 ID
+	Stream     string                 // 所在 Stream
+	Data       []byte                 // Publish 写入的负载
+	Values     map[string]interface{} // 原始字段，用于消费非 Publish 写入的消息
+	Deliveries int64                  // 投递次数，首次投递为 1
+}
+
+// Decode 按 GetRedis 的规则将负载解码到 dst
+func (m *StreamMessage) Decode(dst interface{}) error {
+	return decodeValue(m.Data, dst)
+}
+
+// StreamHandler 消息处理函数，返回 nil 时确认消息；返回错误的消息保留在待处理列表中，空闲超过 ClaimIdle 后重新投递
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// ConsumerOptions 定义消费者可选参数
+type ConsumerOptions struct {
+	Group         string        // 消费者组，必填；同组的多个消费者分摊消息
+	Consumer      string        // 消费者名称，默认 "<hostname>-<随机串>"；固定名称可在重启后优先取回自己的待处理消息
+	StartID       string        // 消费者组不存在时的起始位置，默认 "$"（只消费新消息），"0" 表示从头消费
+	BatchSize     int64         // 每次读取的消息数，默认 10
+	Block         time.Duration // 无消息时阻塞等待的时间，同时决定 Stop 的最长等待，默认 2s
+	ClaimIdle     time.Duration // 待处理消息空闲超过该时间后被重新投递（处理失败或消费者崩溃），默认 1 分钟
+	ClaimInterval time.Duration // 检查待处理消息的间隔，默认等于 ClaimIdle
+	MaxDeliveries int64         // 最大投递次数，超过后转入死信 Stream 并确认，默认 5
+	DeadLetter    string        // 死信 Stream，默认 "<stream>:dead"
+}
+
+// Consumer 基于 Redis Streams 消费者组的消费者
+//
+// 实现了 Kratos transport.Server，可通过 kratos.Server 注册，随应用启动与停止。
+// 消息在同一个 goroutine 中按顺序处理，需要并发处理时可用相同的组创建多个 Consumer
+type Consumer struct {
+	c       *Cache
+	stream  string
+	handler StreamHandler
+	options ConsumerOptions
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Publish 向 Stream 发布消息，value 按 SetRedis 的规则编码，返回消息 ID
+func (c *Cache) Publish(ctx context.Context, stream string, value interface{}, options ...PublishOptions) (string, error) {
+	data, err := encodeValue(c.codec, value)
+	if err != nil {
+		return "", err
+	}
+	args := &redis.XAddArgs{Stream: stream, Values: []interface{}{streamDataField, data}}
+	if len(options) > 0 && options[0].MaxLen > 0 {
+		args.MaxLen = options[0].MaxLen
+		args.Approx = true
+	}
+	return c.redis.XAdd(ctx, args).Result()
+}
+
+// NewConsumer 创建 Stream 消费者，调用 Start 后开始消费
+func (c *Cache) NewConsumer(stream string, handler StreamHandler, options ConsumerOptions) *Consumer {
+	if options.Consumer == "" {
+		host, _ := os.Hostname()
+		suffix, _ := randomHex(4)
+		options.Consumer = host + "-" + suffix
+	}
+	if options.StartID == "" {
+		options.StartID = "$"
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultConsumerBatchSize
+	}
+	if options.Block <= 0 {
+		options.Block = defaultConsumerBlock
+	}
+	if options.ClaimIdle <= 0 {
+		options.ClaimIdle = defaultConsumerClaimIdle
+	}
+	if options.ClaimInterval <= 0 {
+		options.ClaimInterval = options.ClaimIdle
+	}
+	if options.MaxDeliveries <= 0 {
+		options.MaxDeliveries = defaultConsumerMaxDeliveries
+	}
+	if options.DeadLetter == "" {
+		options.DeadLetter = stream + defaultDeadLetterSuffix
+	}
+	return &Consumer{
+		c:       c,
+		stream:  stream,
+		handler: handler,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 创建消费者组（已存在时忽略）并开始消费，阻塞直到 Stop 被调用或 ctx 结束
+//
+// 处理函数收到的 ctx 不会随 ctx 取消，Stop 会等待正在处理的消息完成
+func (cs *Consumer) Start(ctx context.Context) error {
+	if cs.options.Group == "" {
+		return errors.New("stream: consumer group is required")
+	}
+	cs.mu.Lock()
+	if cs.started {
+		cs.mu.Unlock()
+		return errConsumerStarted
+	}
+	cs.started = true
+	cs.mu.Unlock()
+	defer close(cs.done)
+
+	if err := cs.ensureGroup(ctx); err != nil {
+		return err
+	}
+
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-cs.stop:
+			cancel()
+		case <-readCtx.Done():
+		}
+	}()
+	handlerCtx := context.WithoutCancel(ctx)
+
+	var lastClaim time.Time
+	for readCtx.Err() == nil {
+		if time.Since(lastClaim) >= cs.options.ClaimInterval {
+			if _, err := cs.reclaim(readCtx, handlerCtx); err != nil && readCtx.Err() == nil {
+				cs.c.logf("reclaim pending messages of stream %s failed: %v", cs.stream, err)
+			}
+			lastClaim = time.Now()
+		}
+
+		streams, err := cs.c.redis.XReadGroup(readCtx, &redis.XReadGroupArgs{
+			Group:    cs.options.Group,
+			Consumer: cs.options.Consumer,
+			Streams:  []string{cs.stream, ">"},
+			Count:    cs.options.BatchSize,
+			Block:    cs.options.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || readCtx.Err() != nil {
+				continue
+			}
+			cs.c.logf("read stream %s failed: %v", cs.stream, err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				_ = cs.ensureGroup(readCtx)
+			}
+			select {
+			case <-readCtx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				cs.handle(handlerCtx, msg, 1)
+			}
+		}
+	}
+	return nil
+}
+
+// Stop 停止消费并等待正在处理的消息完成，等待受 ctx 控制
+func (cs *Consumer) Stop(ctx context.Context) error {
+	cs.mu.Lock()
+	started := cs.started
+	select {
+	case <-cs.stop:
+	default:
+		close(cs.stop)
+	}
+	cs.mu.Unlock()
+	if !started {
+		return nil
+	}
+	select {
+	case <-cs.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reclaim 立即检查一次待处理消息：空闲超过 ClaimIdle 的消息重新投递给当前消费者，
+// 超过 MaxDeliveries 的消息转入死信 Stream。返回重新投递与转入死信的消息数。
+// Start 会按 ClaimInterval 自动调用，一般无需手动调用
+func (cs *Consumer) Reclaim(ctx context.Context) (int, error) {
+	return cs.reclaim(ctx, ctx)
+}
+
+// reclaim 分批检查待处理消息，ctx 用于 Redis 命令，handlerCtx 传给处理函数
+func (cs *Consumer) reclaim(ctx, handlerCtx context.Context) (int, error) {
+	var n int
+	start := "-"
+	for {
+		pending, err := cs.c.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: cs.stream,
+			Group:  cs.options.Group,
+			Idle:   cs.options.ClaimIdle,
+			Start:  start,
+			End:    "+",
+			Count:  cs.options.BatchSize,
+		}).Result()
+		if err != nil {
+			return n, err
+		}
+		if len(pending) == 0 {
+			return n, nil
+		}
+
+		deliveries := make(map[string]int64, len(pending))
+		var claim []string
+		for _, p := range pending {
+			if p.RetryCount >= cs.options.MaxDeliveries {
+				if err := cs.deadLetter(ctx, p.ID, p.RetryCount); err != nil {
+					return n, err
+				}
+				n++
+				continue
+			}
+			deliveries[p.ID] = p.RetryCount + 1
+			claim = append(claim, p.ID)
+		}
+		if len(claim) > 0 {
+			messages, err := cs.c.redis.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   cs.stream,
+				Group:    cs.options.Group,
+				Consumer: cs.options.Consumer,
+				MinIdle:  cs.options.ClaimIdle,
+				Messages: claim,
+			}).Result()
+			if err != nil {
+				return n, err
+			}
+			for _, msg := range messages {
+				cs.handle(handlerCtx, msg, deliveries[msg.ID])
+				n++
+			}
+		}
+		if int64(len(pending)) < cs.options.BatchSize {
+			return n, nil
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+}
+
+// deadLetter 将消息转入死信 Stream 并确认；消息已被裁剪时直接确认
+func (cs *Consumer) deadLetter(ctx context.Context, id string, deliveries int64) error {
+	messages, err := cs.c.redis.XRangeN(ctx, cs.stream, id, id, 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		values := []interface{}{
+			"stream", cs.stream,
+			"id", id,
+			"group", cs.options.Group,
+			"deliveries", strconv.FormatInt(deliveries, 10),
+		}
+		for k, v := range messages[0].Values {
+			values = append(values, k, v)
+		}
+		if err := cs.c.redis.XAdd(ctx, &redis.XAddArgs{Stream: cs.options.DeadLetter, Values: values}).Err(); err != nil {
+			return err
+		}
+	}
+	return cs.c.redis.XAck(ctx, cs.stream, cs.options.Group, id).Err()
+}
+
+// handle 调用处理函数，成功时确认消息
+func (cs *Consumer) handle(ctx context.Context, msg redis.XMessage, deliveries int64) {
+	m := &StreamMessage{ID: msg.ID, Stream: cs.stream, Values: msg.Values, Deliveries: deliveries}
+	if data, ok := msg.Values[streamDataField].(string); ok {
+		m.Data = []byte(data)
+	}
+	if err := cs.invoke(ctx, m); err != nil {
+		cs.c.logf("handle message %s of stream %s failed (delivery %d): %v", msg.ID, cs.stream, deliveries, err)
+		return
+	}
+	if err := cs.c.redis.XAck(ctx, cs.stream, cs.options.Group, msg.ID).Err(); err != nil {
+		cs.c.logf("ack message %s of stream %s failed: %v", msg.ID, cs.stream, err)
+	}
+}
+
+// invoke 调用处理函数，panic 视为处理失败
+func (cs *Consumer) invoke(ctx context.Context, msg *StreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return cs.handler(ctx, msg)
+}
+
+// ensureGroup 创建消费者组，Stream 不存在时一并创建
+func (cs *Consumer) ensureGroup(ctx context.Context) error {
+	err := cs.c.redis.XGroupCreateMkStream(ctx, cs.stream, cs.options.Group, cs.options.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package nie_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	nie "github.com/sca-rab/nie-go"
+	"github.com/sca-rab/nie-go/nietest"
+)
+
+func TestConsumer_AckAndReclaim(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+
+	type event struct {
+		user       cacheUser
+		deliveries int64
+	}
+	events := make(chan event, 10)
+	var failOnce sync.Once
+	consumer := c.NewConsumer("events:user", func(ctx context.Context, msg *nie.StreamMessage) error {
+		var u cacheUser
+		if err := msg.Decode(&u); err != nil {
+			return err
+		}
+		events <- event{user: u, deliveries: msg.Deliveries}
+		var err error
+		failOnce.Do(func() { err = errors.New("temporary failure") })
+		return err
+	}, nie.ConsumerOptions{Group: "cache", Block: 10 * time.Millisecond, ClaimIdle: time.Minute, ClaimInterval: time.Hour})
+
+	started := make(chan error, 1)
+	go func() { started <- consumer.Start(ctx) }()
+	t.Cleanup(func() {
+		if err := consumer.Stop(ctx); err != nil {
+			t.Errorf("Stop error: %v", err)
+		}
+		if err := <-started; err != nil {
+			t.Errorf("Start error: %v", err)
+		}
+	})
+
+	// 等待消费者组创建完成后再发布，StartID 默认只消费新消息
+	for !r.Server().Exists("events:user") {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.Publish(ctx, "events:user", cacheUser{ID: 1, Name: "a"}, nie.PublishOptions{MaxLen: 1000}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if e := <-events; e.user.ID != 1 || e.deliveries != 1 {
+		t.Fatalf("first delivery = %+v", e)
+	}
+
+	// 处理失败的消息空闲超过 ClaimIdle 后重新投递
+	if n, err := consumer.Reclaim(ctx); err != nil || n != 0 {
+		t.Fatalf("Reclaim before idle = %d, %v", n, err)
+	}
+	r.Advance(time.Minute)
+	if n, err := consumer.Reclaim(ctx); err != nil || n != 1 {
+		t.Fatalf("Reclaim = %d, %v", n, err)
+	}
+	if e := <-events; e.user.ID != 1 || e.deliveries != 2 {
+		t.Fatalf("redelivery = %+v", e)
+	}
+	r.Advance(time.Minute)
+	if n, _ := consumer.Reclaim(ctx); n != 0 {
+		t.Fatalf("acked message should not be reclaimed, got %d", n)
+	}
+}
+
+func TestConsumer_DeadLetter(t *testing.T) {
+	c, r := nietest.NewCache(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var deliveries []int64
+	consumer := c.NewConsumer("events:order", func(ctx context.Context, msg *nie.StreamMessage) error {
+		mu.Lock()
+		deliveries = append(deliveries, msg.Deliveries)
+		mu.Unlock()
+		panic("handler bug")
+	}, nie.ConsumerOptions{Group: "notify", StartID: "0", MaxDeliveries: 2, ClaimIdle: time.Second})
+
+	if _, err := c.Publish(ctx, "events:order", "order-1"); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	go consumer.Start(ctx)
+	for {
+		mu.Lock()
+		n := len(deliveries)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := consumer.Stop(ctx); err != nil {
+		t.Fatalf("Stop error: %v", err)
+	}
+
+	r.Advance(time.Second)
+	if n, err := consumer.Reclaim(ctx); err != nil || n != 1 {
+		t.Fatalf("Reclaim = %d, %v", n, err)
+	}
+	r.Advance(time.Second)
+	if n, err := consumer.Reclaim(ctx); err != nil || n != 1 {
+		t.Fatalf("Reclaim to dead letter = %d, %v", n, err)
+	}
+	if len(deliveries) != 2 || deliveries[1] != 2 {
+		t.Fatalf("deliveries = %v", deliveries)
+	}
+
+	dead, err := r.Client().XRange(ctx, "events:order:dead", "-", "+").Result()
+	if err != nil || len(dead) != 1 || dead[0].Values["data"] != "order-1" || dead[0].Values["deliveries"] != "2" {
+		t.Fatalf("dead letter = %+v, %v", dead, err)
+	}
+	pending, _ := r.Client().XPending(ctx, "events:order", "notify").Result()
+	if pending.Count != 0 {
+		t.Fatalf("dead-lettered message should be acked, pending = %d", pending.Count)
+	}
+}